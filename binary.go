@@ -0,0 +1,338 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// Binary wire format:
+//
+//	magic   "CMAP"
+//	version 1 byte, binaryVersion
+//	kinds   1 byte key kind, 1 byte value kind
+//	count   uvarint
+//	entries count times key then value
+//
+// Strings and byte slices are a uvarint length followed by the bytes,
+// signed integers are varints, unsigned integers uvarints, floats are
+// 8 bytes IEEE 754 little endian and bools 1 byte. Other types are gob
+// messages of a single gob stream interleaved with the entries.
+//
+// 二进制格式:
+// 字符串和字节切片为 uvarint 长度加字节, 有符号整数为 varint, 无符号整数为 uvarint,
+// 浮点数为8字节小端 IEEE 754, 布尔值为1字节. 其他类型为穿插在元素之间的同一个gob流中的gob消息.
+
+const (
+	binaryMagic   = "CMAP"
+	binaryVersion = 1
+)
+
+var (
+	// ErrInvalidFormat is returned when decoding malformed binary data.
+	//
+	// 解码格式错误的二进制数据时返回 ErrInvalidFormat
+	ErrInvalidFormat = errors.New("cmap: invalid binary format")
+	// ErrUnsupportedVersion is returned when decoding binary data of an unknown format version.
+	//
+	// 解码未知格式版本的二进制数据时返回 ErrUnsupportedVersion
+	ErrUnsupportedVersion = errors.New("cmap: unsupported binary format version")
+)
+
+// binaryKind is how a key or value type is encoded.
+//
+// binaryKind 表示key或值类型的编码方式
+type binaryKind byte
+
+const (
+	kindGob binaryKind = iota
+	kindString
+	kindBytes
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+)
+
+func binaryKindOf(t reflect.Type) binaryKind {
+	switch t.Kind() {
+	case reflect.String:
+		return kindString
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return kindBytes
+		}
+	case reflect.Bool:
+		return kindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return kindInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return kindUint
+	case reflect.Float32, reflect.Float64:
+		return kindFloat
+	}
+	return kindGob
+}
+
+// binaryWriter encodes keys and values.
+//
+// binaryWriter 编码key和值
+type binaryWriter struct {
+	buf bytes.Buffer
+	enc *gob.Encoder
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (w *binaryWriter) uvarint(x uint64) {
+	w.buf.Write(w.tmp[:binary.PutUvarint(w.tmp[:], x)])
+}
+
+func (w *binaryWriter) write(kind binaryKind, v reflect.Value) error {
+	switch kind {
+	case kindString:
+		w.uvarint(uint64(v.Len()))
+		w.buf.WriteString(v.String())
+	case kindBytes:
+		w.uvarint(uint64(v.Len()))
+		w.buf.Write(v.Bytes())
+	case kindBool:
+		if v.Bool() {
+			w.buf.WriteByte(1)
+		} else {
+			w.buf.WriteByte(0)
+		}
+	case kindInt:
+		w.buf.Write(w.tmp[:binary.PutVarint(w.tmp[:], v.Int())])
+	case kindUint:
+		w.uvarint(v.Uint())
+	case kindFloat:
+		binary.LittleEndian.PutUint64(w.tmp[:8], math.Float64bits(v.Float()))
+		w.buf.Write(w.tmp[:8])
+	default:
+		if w.enc == nil {
+			w.enc = gob.NewEncoder(&w.buf)
+		}
+		return w.enc.EncodeValue(v)
+	}
+	return nil
+}
+
+// binaryReader decodes keys and values.
+//
+// binaryReader 解码key和值
+type binaryReader struct {
+	r   *bytes.Reader
+	dec *gob.Decoder
+}
+
+func (r *binaryReader) uvarint() (uint64, error) {
+	x, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return 0, ErrInvalidFormat
+	}
+	return x, nil
+}
+
+func (r *binaryReader) bytes() ([]byte, error) {
+	n, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.r.Len()) {
+		return nil, ErrInvalidFormat
+	}
+	b := make([]byte, n)
+	_, _ = io.ReadFull(r.r, b)
+	return b, nil
+}
+
+// read decodes into v, which must be settable.
+//
+// read 解码到 v, v 必须可设置
+func (r *binaryReader) read(kind binaryKind, v reflect.Value) error {
+	switch kind {
+	case kindString:
+		b, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case kindBytes:
+		b, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+	case kindBool:
+		b, err := r.r.ReadByte()
+		if err != nil || b > 1 {
+			return ErrInvalidFormat
+		}
+		v.SetBool(b == 1)
+	case kindInt:
+		x, err := binary.ReadVarint(r.r)
+		if err != nil || v.OverflowInt(x) {
+			return ErrInvalidFormat
+		}
+		v.SetInt(x)
+	case kindUint:
+		x, err := r.uvarint()
+		if err != nil || v.OverflowUint(x) {
+			return ErrInvalidFormat
+		}
+		v.SetUint(x)
+	case kindFloat:
+		var b [8]byte
+		if _, err := io.ReadFull(r.r, b[:]); err != nil {
+			return ErrInvalidFormat
+		}
+		v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b[:])))
+	default:
+		if r.dec == nil {
+			r.dec = gob.NewDecoder(r.r)
+		}
+		return r.dec.DecodeValue(v)
+	}
+	return nil
+}
+
+// encodeBinary encodes items in the binary wire format.
+//
+// encodeBinary 以二进制格式编码 items
+func encodeBinary[K comparable, V any](items []Tuple[K, V]) ([]byte, error) {
+	keyKind := binaryKindOf(reflect.TypeOf((*K)(nil)).Elem())
+	valKind := binaryKindOf(reflect.TypeOf((*V)(nil)).Elem())
+
+	w := &binaryWriter{}
+	w.buf.WriteString(binaryMagic)
+	w.buf.WriteByte(binaryVersion)
+	w.buf.WriteByte(byte(keyKind))
+	w.buf.WriteByte(byte(valKind))
+	w.uvarint(uint64(len(items)))
+	for i := range items {
+		if err := w.write(keyKind, reflect.ValueOf(&items[i].Key).Elem()); err != nil {
+			return nil, err
+		}
+		if err := w.write(valKind, reflect.ValueOf(&items[i].Val).Elem()); err != nil {
+			return nil, err
+		}
+	}
+	return w.buf.Bytes(), nil
+}
+
+// binaryKey returns the binary encoding of key alone.
+//
+// binaryKey 返回单独编码key的二进制数据
+func binaryKey[K comparable](key K) ([]byte, error) {
+	w := &binaryWriter{}
+	err := w.write(binaryKindOf(reflect.TypeOf((*K)(nil)).Elem()), reflect.ValueOf(&key).Elem())
+	return w.buf.Bytes(), err
+}
+
+// decodeBinary decodes data in the binary wire format, calling fn for every entry.
+//
+// decodeBinary 解码二进制格式的 data, 对每个元素调用 fn
+func decodeBinary[K comparable, V any](data []byte, fn func(key K, val V) error) error {
+	keyKind := binaryKindOf(reflect.TypeOf((*K)(nil)).Elem())
+	valKind := binaryKindOf(reflect.TypeOf((*V)(nil)).Elem())
+
+	if len(data) < len(binaryMagic)+3 || string(data[:len(binaryMagic)]) != binaryMagic {
+		return ErrInvalidFormat
+	}
+	header := data[len(binaryMagic):]
+	if header[0] != binaryVersion {
+		return ErrUnsupportedVersion
+	}
+	if binaryKind(header[1]) != keyKind || binaryKind(header[2]) != valKind {
+		return fmt.Errorf("%w: encoded kinds %d/%d, map kinds %d/%d", ErrInvalidFormat, header[1], header[2], keyKind, valKind)
+	}
+
+	r := &binaryReader{r: bytes.NewReader(header[3:])}
+	count, err := r.uvarint()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		var (
+			key K
+			val V
+		)
+		if err := r.read(keyKind, reflect.ValueOf(&key).Elem()); err != nil {
+			return err
+		}
+		if err := r.read(valKind, reflect.ValueOf(&val).Elem()); err != nil {
+			return err
+		}
+		if err := fn(key, val); err != nil {
+			return err
+		}
+	}
+	if r.r.Len() != 0 {
+		return ErrInvalidFormat
+	}
+	return nil
+}
+
+// MarshalBinary encodes a point-in-time Snapshot of the map in a compact,
+// versioned binary format, sorted by key with WithCanonical or WithKeyOrder.
+// gob encoded values holding maps are not canonical.
+//
+// MarshalBinary 以紧凑且带版本的二进制格式编码map在某一时刻的快照(Snapshot),
+// 使用 WithCanonical 或 WithKeyOrder 时按key排序. 包含map的gob编码值不是规范的.
+func (m ConcurrentMap[K, V]) MarshalBinary() ([]byte, error) {
+	items, err := m.binaryItems()
+	if err != nil {
+		return nil, err
+	}
+	return encodeBinary(items)
+}
+
+// binaryItems returns the entries MarshalBinary encodes, in order.
+//
+// binaryItems 按顺序返回 MarshalBinary 编码的元素
+func (m ConcurrentMap[K, V]) binaryItems() ([]Tuple[K, V], error) {
+	items := m.snapshotItems()
+	if ok, less := m.canonical(); ok {
+		if err := sortItems(items, less, binaryKey[K]); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary into the map,
+// combining entries as set by WithMergePolicy. The whole input is decoded
+// before the map is modified. A zero value map is initialized first.
+//
+// UnmarshalBinary 将 MarshalBinary 生成的数据解码到map中, 按照 WithMergePolicy 的设置合并元素.
+// 在修改map之前会解码全部输入. 零值map会先被初始化.
+func (m *ConcurrentMap[K, V]) UnmarshalBinary(data []byte) error {
+	var items []Tuple[K, V]
+	err := decodeBinary(data, func(key K, val V) error {
+		items = append(items, Tuple[K, V]{key, val})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return m.mergeAll(items, nil)
+}
+
+// GobEncode implements gob.GobEncoder with the MarshalBinary format.
+//
+// GobEncode 以 MarshalBinary 的格式实现 gob.GobEncoder.
+func (m ConcurrentMap[K, V]) GobEncode() ([]byte, error) {
+	return m.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder with the MarshalBinary format.
+//
+// GobDecode 以 MarshalBinary 的格式实现 gob.GobDecoder.
+func (m *ConcurrentMap[K, V]) GobDecode(data []byte) error {
+	return m.UnmarshalBinary(data)
+}
@@ -0,0 +1,154 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+type coord struct {
+	X, Y int
+}
+
+type record struct {
+	Name  string
+	Score float64
+	Tags  []string
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	m := New[int]()
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), -i)
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := New[int]()
+	if err := n.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if n.Count() != 100 {
+		t.Error("Expecting 100 element within map.")
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := n.Get(strconv.Itoa(i)); !ok || v != -i {
+			t.Error("missing value", i)
+		}
+	}
+}
+
+func TestBinaryKinds(t *testing.T) {
+	b := NewInt[uint16, []byte]()
+	b.Set(7, []byte{0, 1, 2})
+	b.Set(65535, nil)
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2 := NewInt[uint16, []byte]()
+	if err := b2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := b2.Get(7); !bytes.Equal(v, []byte{0, 1, 2}) || !b2.Has(65535) {
+		t.Error("binary values were modified")
+	}
+
+	f := NewComparable[float64, bool]()
+	f.Set(1.5, true)
+	f.Set(-2, false)
+	data, err = f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2 := NewComparable[float64, bool]()
+	if err := f2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := f2.Get(1.5); !ok || !v || f2.Count() != 2 {
+		t.Error("float keys were modified")
+	}
+
+	s := NewComparable[coord, record]()
+	s.Set(coord{1, 2}, record{"x", 0.5, []string{"t"}})
+	s.Set(coord{3, 4}, record{Name: "y"})
+	data, err = s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2 := NewComparable[coord, record]()
+	if err := s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := s2.Get(coord{1, 2}); !ok || v.Name != "x" || s2.Count() != 2 {
+		t.Error("gob encoded entries were modified", v)
+	}
+}
+
+func TestBinaryStruct(t *testing.T) {
+	m := New[record]()
+	m.Set("a", record{"x", 0.5, []string{"t"}})
+	m.Set("b", record{Name: "y"})
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := New[record]()
+	if err := n.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := n.Get("a"); !ok || v.Name != "x" || v.Score != 0.5 || len(v.Tags) != 1 {
+		t.Error("struct value was modified", v)
+	}
+	if v, ok := n.Get("b"); !ok || v.Name != "y" {
+		t.Error("struct value was modified", v)
+	}
+}
+
+func TestGob(t *testing.T) {
+	type wrapper struct {
+		Animals ConcurrentMap[string, int]
+	}
+	m := New[int]()
+	m.Set("elephant", 1)
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(wrapper{m}); err != nil {
+		t.Fatal(err)
+	}
+	w := wrapper{New[int]()}
+	if err := gob.NewDecoder(&buf).Decode(&w); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := w.Animals.Get("elephant"); !ok || v != 1 {
+		t.Error("gob round trip failed")
+	}
+}
+
+func TestBinaryInvalid(t *testing.T) {
+	m := New[int]()
+	m.Set("a", 1)
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := New[int]()
+	if err := n.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("truncated data should be rejected")
+	}
+	if err := n.UnmarshalBinary(append(data, 0)); !errors.Is(err, ErrInvalidFormat) {
+		t.Error("trailing data should be rejected, got", err)
+	}
+	bad := append([]byte{}, data...)
+	bad[4] = 99
+	if err := n.UnmarshalBinary(bad); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Error("unknown version should be rejected, got", err)
+	}
+	str := New[string]()
+	if err := str.UnmarshalBinary(data); !errors.Is(err, ErrInvalidFormat) {
+		t.Error("mismatched value type should be rejected, got", err)
+	}
+}
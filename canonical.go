@@ -0,0 +1,131 @@
+package cmap
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// WithCanonical makes EncodeJSON, MarshalJSON, MarshalBinary and GobEncode
+// write their entries sorted by key in natural order, so equal maps encode
+// to equal bytes. Strings, integers and floats are ordered by value, other
+// keys by their encoded form. EncodeJSON then copies the whole map instead
+// of one shard at a time.
+//
+// WithCanonical 使 EncodeJSON, MarshalJSON, MarshalBinary 和 GobEncode 按key的自然顺序输出元素,
+// 相等的map会被编码为相同的字节. 字符串, 整数和浮点数按值排序, 其他key按编码后的形式排序.
+// 此时 EncodeJSON 会复制整个map而不是每次复制一个分片.
+func WithCanonical() Option {
+	return func(o *options) {
+		o.canonical = true
+	}
+}
+
+// WithKeyOrder is WithCanonical with entries sorted by less instead of the
+// natural order. less must be a strict weak ordering of the keys.
+//
+// WithKeyOrder 与 WithCanonical 相同, 但元素按 less 而不是自然顺序排序. less 必须是key的严格弱序.
+func WithKeyOrder[K comparable](less func(a, b K) bool) Option {
+	return func(o *options) {
+		o.canonical = true
+		o.keyLess = less
+	}
+}
+
+// canonical reports whether the map writes canonical output, and the key
+// order to use; a nil order means natural order.
+//
+// canonical 返回map是否输出规范格式, 以及使用的key顺序; 顺序为 nil 表示自然顺序.
+func (m ConcurrentMap[K, V]) canonical() (bool, func(a, b K) bool) {
+	if m.state == nil || !m.state.canonical {
+		return false, nil
+	}
+	return true, m.state.keyLess
+}
+
+// naturalLess returns the natural order of ordered key kinds, nil for other keys.
+//
+// naturalLess 返回有序key类型的自然顺序, 其他key返回 nil
+func naturalLess[K comparable]() func(a, b K) bool {
+	switch reflect.TypeOf((*K)(nil)).Elem().Kind() {
+	case reflect.String:
+		return func(a, b K) bool {
+			return reflect.ValueOf(&a).Elem().String() < reflect.ValueOf(&b).Elem().String()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(a, b K) bool {
+			return reflect.ValueOf(&a).Elem().Int() < reflect.ValueOf(&b).Elem().Int()
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(a, b K) bool {
+			return reflect.ValueOf(&a).Elem().Uint() < reflect.ValueOf(&b).Elem().Uint()
+		}
+	case reflect.Float32, reflect.Float64:
+		// NaN sorts first so that the order stays total.
+		// NaN 排在最前以保证全序
+		return func(a, b K) bool {
+			x, y := reflect.ValueOf(&a).Elem().Float(), reflect.ValueOf(&b).Elem().Float()
+			return x < y || math.IsNaN(x) && !math.IsNaN(y)
+		}
+	}
+	return nil
+}
+
+// sortItems sorts items by less, or by the natural order when less is nil,
+// falling back to the bytes of encode(key) for keys without one.
+//
+// sortItems 按 less 排序 items, less 为 nil 时按自然顺序排序, 没有自然顺序的key按 encode(key) 的字节排序.
+func sortItems[K comparable, V any](items []Tuple[K, V], less func(a, b K) bool, encode func(key K) ([]byte, error)) error {
+	if less == nil {
+		less = naturalLess[K]()
+	}
+	if less != nil {
+		sort.Slice(items, func(i, j int) bool { return less(items[i].Key, items[j].Key) })
+		return nil
+	}
+	return sortEncoded(items, encode)
+}
+
+// sortEncoded sorts items by the bytes of encode(key).
+//
+// sortEncoded 按 encode(key) 的字节排序 items
+func sortEncoded[K comparable, V any](items []Tuple[K, V], encode func(key K) ([]byte, error)) error {
+	keys := make([][]byte, len(items))
+	for i := range items {
+		b, err := encode(items[i].Key)
+		if err != nil {
+			return err
+		}
+		keys[i] = b
+	}
+	sort.Sort(byKeyBytes[K, V]{items, keys})
+	return nil
+}
+
+// byKeyBytes sorts items by their encoded keys.
+//
+// byKeyBytes 按编码后的key排序 items
+type byKeyBytes[K comparable, V any] struct {
+	items []Tuple[K, V]
+	keys  [][]byte
+}
+
+func (s byKeyBytes[K, V]) Len() int           { return len(s.items) }
+func (s byKeyBytes[K, V]) Less(i, j int) bool { return bytes.Compare(s.keys[i], s.keys[j]) < 0 }
+func (s byKeyBytes[K, V]) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// snapshotItems returns a point-in-time Snapshot of the map as a slice.
+//
+// snapshotItems 以切片返回map在某一时刻的快照
+func (m ConcurrentMap[K, V]) snapshotItems() []Tuple[K, V] {
+	items := m.Snapshot()
+	tuples := make([]Tuple[K, V], 0, len(items))
+	for key, val := range items {
+		tuples = append(tuples, Tuple[K, V]{key, val})
+	}
+	return tuples
+}
@@ -0,0 +1,126 @@
+package cmap
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	m, err := NewWithOptions[int, string](WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := NewInt[int, string]()
+	for _, i := range []int{10, -1, 2} {
+		m.Set(i, "v")
+		plain.Set(i, "v")
+	}
+	data, err := m.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"-1":"v","2":"v","10":"v"}` {
+		t.Error("canonical JSON should be in natural order, got", string(data))
+	}
+	buf := bytes.Buffer{}
+	if err := m.EncodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(data) {
+		t.Error("EncodeJSON", buf.String(), "differ from MarshalJSON", string(data))
+	}
+	data, err = plain.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"-1":"v","10":"v","2":"v"}` {
+		t.Error("JSON should be sorted by encoded key like encoding/json, got", string(data))
+	}
+}
+
+func TestWithKeyOrder(t *testing.T) {
+	m, err := NewWithOptions[string, int](WithKeyOrder(func(a, b string) bool { return a > b }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set("a", 1)
+	m.Set("c", 3)
+	m.Set("b", 2)
+	buf := bytes.Buffer{}
+	if err := m.EncodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"c":3,"b":2,"a":1}` {
+		t.Error("JSON should follow the key order, got", buf.String())
+	}
+
+	if _, err := NewWithOptions[int, int](WithKeyOrder(func(a, b string) bool { return a < b })); err == nil {
+		t.Error("key order of another key type should be rejected")
+	}
+}
+
+func TestCanonicalBinary(t *testing.T) {
+	encode := func(shards int, keys []coord) []byte {
+		m, err := NewWithOptions[coord, int](WithCanonical(), WithShardCount(shards))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, key := range keys {
+			m.Set(key, key.X+key.Y)
+			if i%2 == 0 {
+				m.Set(coord{-i - 1, -1}, 0)
+				m.Remove(coord{-i - 1, -1})
+			}
+		}
+		data, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	var keys []coord
+	for i := 0; i < 100; i++ {
+		keys = append(keys, coord{i, i * 7 % 13})
+	}
+	expected := encode(32, keys)
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	if !bytes.Equal(encode(3, keys), expected) {
+		t.Error("equal maps should encode to equal bytes")
+	}
+
+	n := NewComparable[coord, int]()
+	if err := n.UnmarshalBinary(expected); err != nil {
+		t.Fatal(err)
+	}
+	if n.Count() != 100 {
+		t.Error("Expecting 100 elements.")
+	}
+}
+
+func TestCanonicalFloatKeys(t *testing.T) {
+	m, err := NewWithOptions[float64, int](WithCanonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set(1.5, 1)
+	m.Set(math.NaN(), 0)
+	m.Set(-2, 2)
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []float64
+	err = decodeBinary(data, func(key float64, val int) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || !math.IsNaN(keys[0]) || keys[1] != -2 || keys[2] != 1.5 {
+		t.Error("float keys should sort NaN first then by value, got", keys)
+	}
+}
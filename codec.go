@@ -0,0 +1,54 @@
+package cmap
+
+import (
+	"encoding/json"
+)
+
+// Codec marshals the keys' and values' JSON in MarshalJSON, UnmarshalJSON,
+// EncodeJSON and DecodeJSON. encoding/json is used by default, the
+// cmap/jsoniter subpackage provides a jsoniter based Codec.
+//
+// Codec 用于 MarshalJSON, UnmarshalJSON, EncodeJSON 和 DecodeJSON 中键和值的JSON编解码.
+// 默认使用 encoding/json, 子包 cmap/jsoniter 提供基于 jsoniter 的 Codec.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// StdCodec is the Codec backed by encoding/json.
+//
+// StdCodec 是基于 encoding/json 的 Codec
+type StdCodec struct{}
+
+// Marshal calls json.Marshal.
+//
+// Marshal 调用 json.Marshal
+func (StdCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal calls json.Unmarshal.
+//
+// Unmarshal 调用 json.Unmarshal
+func (StdCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// WithCodec sets the JSON codec of the map, StdCodec by default.
+//
+// WithCodec 设置map的JSON编解码器, 默认为 StdCodec
+func WithCodec(c Codec) Option {
+	return func(o *options) {
+		o.codec = c
+	}
+}
+
+// codec returns the JSON codec of the map.
+//
+// codec 返回map的JSON编解码器
+func (m ConcurrentMap[K, V]) codec() Codec {
+	if m.state == nil || m.state.codec == nil {
+		return StdCodec{}
+	}
+	return m.state.codec
+}
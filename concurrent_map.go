@@ -1,16 +1,17 @@
 package cmap
 
 import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
 	"fmt"
+	"hash/maphash"
 	"sync"
-
-	jsoniter "github.com/json-iterator/go"
+	"sync/atomic"
+	"time"
 )
 
-var (
-	SHARD_COUNT = 32 // 默认map分片数量
-	json        = jsoniter.ConfigCompatibleWithStandardLibrary
-)
+var SHARD_COUNT = 32 // 默认map分片数量
 
 type Stringer interface {
 	fmt.Stringer
@@ -23,72 +24,159 @@ type Stringer interface {
 // 一个 "线程" 安全的map 类型为 string:Anything
 // 为了避免锁瓶颈，该map被划分为多个(SHARD_COUNT) 分片计数map。
 type ConcurrentMap[K comparable, V any] struct {
-	shards   []*ConcurrentMapShared[K, V] // map分片
-	sharding func(key K) uint32           // 分片
+	state    *mapState[K, V]    // 分片表等共享状态
+	sharding func(key K) uint32 // 分片
 }
 
 // A "thread" safe string to anything map.
 //
 // 一个key为string的线程安全的任意map
 type ConcurrentMapShared[K comparable, V any] struct {
-	items        map[K]V // 内部map分片
-	sync.RWMutex         // 读写锁保护对内部map的访问.
+	items        map[K]V     // 内部map分片
+	expires      map[K]int64 // 设置了过期时间的key的过期时间(UnixNano), 可为 nil
+	lru          *lru[K]     // 使用顺序, 仅在限制元素数量时非 nil
+	stats        *shardStats // 统计计数, 仅在开启统计时非 nil
+	migrated     int32       // 分片是否已被迁移到新的分片表
+	sync.RWMutex             // 读写锁保护对内部map的访问.
+}
+
+// mapState is shared by all copies of a ConcurrentMap.
+//
+// mapState 由 ConcurrentMap 的所有副本共享
+type mapState[K comparable, V any] struct {
+	table       atomic.Value      // *shardTable[K, V], 当前分片表
+	capacity    int               // 每个分片的初始容量
+	reshardMu   sync.Mutex        // 同一时间只允许一次重新分片
+	maxLoad     int               // 自动重新分片的单分片元素数量阈值, 0 表示关闭
+	maxShards   int               // 自动重新分片的分片数量上限, 0 表示不限制
+	growing     int32             // 自动重新分片是否正在进行
+	maxEntries  int               // 元素数量上限, 超出时淘汰最近最少使用的元素, 0 表示不限制
+	merge       MergePolicy       // 解码的元素如何与已有元素合并
+	codec       Codec             // JSON编解码器, nil 表示 StdCodec
+	canonical   bool              // 是否按key排序输出
+	keyLess     func(a, b K) bool // 输出的key顺序, nil 表示自然顺序
+	schema      uint32            // 写入快照文件的值结构版本
+	wal         *wal[K, V]        // 预写日志, 可为 nil
+	watchers    watchers[K, V]    // 订阅者
+	watchBuffer int               // 订阅管道的缓冲区大小
+	watchPolicy WatchPolicy       // 订阅者缓冲区已满时的行为
+	hooks       atomic.Value      // *hookSet[K, V], 已注册的修改回调, 可为 nil
+	hooksMu     sync.Mutex        // 保护回调的注册
+	stats       bool              // 是否开启统计
+
+	defaultTTL  time.Duration // 默认过期时间, 0 表示永不过期
+	cleanup     time.Duration // 清理过期key的间隔
+	janitorMu   sync.Mutex    // 保护 janitor 和 closed
+	janitor     chan struct{} // 关闭以停止后台清理, nil 表示未启动
+	closed      bool          // Close 是否已被调用
+	janitorDone int32         // janitor 已启动或map已关闭, 无需再启动
 }
 
 // Creates a new concurrent map.
 //
 // 创建新的并发map
-func create[K comparable, V any](sharding func(key K) uint32) ConcurrentMap[K, V] {
+func create[K comparable, V any](shardCount int, sharding func(key K) uint32, state *mapState[K, V]) ConcurrentMap[K, V] {
+	if shardCount <= 0 {
+		panic(`cmap: shard count must be positive`)
+	}
 	m := ConcurrentMap[K, V]{
+		state:    state,
 		sharding: sharding,
-		shards:   make([]*ConcurrentMapShared[K, V], SHARD_COUNT),
-	}
-	for i := 0; i < SHARD_COUNT; i++ {
-		m.shards[i] = &ConcurrentMapShared[K, V]{items: make(map[K]V)}
 	}
+	state.table.Store(state.newTable(shardCount))
 	return m
 }
 
 // Creates a new concurrent map.
+// Keys are hashed with the unseeded fnv32, use NewSeeded when keys come
+// from untrusted input.
 //
 // 创建新的并发map
+// key使用不带种子的 fnv32 哈希, key来自不可信的输入时请使用 NewSeeded
 func New[V any]() ConcurrentMap[string, V] {
-	return create[string, V](fnv32)
+	return create[string, V](SHARD_COUNT, fnv32, &mapState[string, V]{})
+}
+
+// Creates a new concurrent map with the given number of shards.
+// Unlike New, it does not read SHARD_COUNT and keys are hashed as in NewSeeded.
+//
+// 使用指定的分片数量创建新的并发map, 不读取 SHARD_COUNT, key的哈希方式与 NewSeeded 相同
+func NewWithShardCount[V any](shardCount int) ConcurrentMap[string, V] {
+	return create[string, V](shardCount, seededHash(maphash.MakeSeed()), &mapState[string, V]{})
 }
 
 // Creates a new concurrent map.
 //
 // 创建新的并发map
 func NewStringer[K Stringer, V any]() ConcurrentMap[K, V] {
-	return create[K, V](strfnv32[K])
+	return create[K, V](SHARD_COUNT, strfnv32[K], &mapState[K, V]{})
 }
 
 // Creates a new concurrent map.
 //
 // 创建新的并发map
 func NewWithCustomShardingFunction[K comparable, V any](sharding func(key K) uint32) ConcurrentMap[K, V] {
-	return create[K, V](sharding)
+	return create[K, V](SHARD_COUNT, sharding, &mapState[K, V]{})
 }
 
-// Get map shard
+// ShardCount returns the number of shards of the map.
 //
-// 获取map分片
+// ShardCount 返回map的分片数量
+func (m ConcurrentMap[K, V]) ShardCount() int {
+	return len(m.table().shards)
+}
+
+// Get map shard. The shard must be locked while the map is used; a shard
+// returned by GetShard may be retired by a concurrent Reshard, so use
+// LockShard or RLockShard to lock it if the map reshards.
+//
+// 获取map分片. 使用期间必须对分片加锁; GetShard 返回的分片可能被并发的 Reshard 弃用,
+// 因此当map会重新分片时, 请使用 LockShard 或 RLockShard 加锁.
 func (cms *ConcurrentMapShared[K, V]) GetMap() map[K]V {
 	return cms.items
 }
 
-// GetShard returns shard under given key
+// GetShard returns shard under given key.
+// The shard is retired by a concurrent Reshard, after which its map is nil,
+// so locking it and then using GetMap is only safe if the map never reshards
+// (neither Reshard nor WithAutoReshard is used). Use LockShard otherwise.
 //
 // GetShard 返回给定key下的map分片, 可进行锁操作
+// 并发的 Reshard 会使该分片失效, 之后其内部map为 nil,
+// 因此只有在map从不重新分片(未使用 Reshard 或 WithAutoReshard)时, 对其加锁后使用 GetMap 才是安全的. 否则请使用 LockShard.
 func (m ConcurrentMap[K, V]) GetShard(key K) *ConcurrentMapShared[K, V] {
-	return m.shards[uint(m.sharding(key))%uint(SHARD_COUNT)]
+	hash := uint(m.sharding(key))
+	for t := m.table(); ; t = t.next {
+		shard := t.shards[hash%uint(len(t.shards))]
+		if atomic.LoadInt32(&shard.migrated) == 0 {
+			return shard
+		}
+	}
+}
+
+// LockShard returns the shard under given key, locked for writing. Unlike
+// locking the result of GetShard, the shard is never one retired by a
+// concurrent Reshard, and no Reshard can retire it until it is unlocked.
+// The caller must call Unlock on it.
+//
+// LockShard 返回给定key下的map分片, 并加写锁. 与对 GetShard 的结果加锁不同,
+// 该分片不会是被并发的 Reshard 弃用的分片, 且在解锁之前不会被 Reshard 弃用. 调用者必须对其调用 Unlock.
+func (m ConcurrentMap[K, V]) LockShard(key K) *ConcurrentMapShared[K, V] {
+	return m.lockShard(key)
+}
+
+// RLockShard is like LockShard, but locks the shard for reading.
+// The caller must call RUnlock on it.
+//
+// RLockShard 与 LockShard 相同, 但加读锁. 调用者必须对其调用 RUnlock.
+func (m ConcurrentMap[K, V]) RLockShard(key K) *ConcurrentMapShared[K, V] {
+	return m.rlockShard(key)
 }
 
 func (m ConcurrentMap[K, V]) MSet(data map[K]V) {
 	for key, value := range data {
-		shard := m.GetShard(key)
-		shard.Lock()
-		shard.items[key] = value
+		shard := m.lockShard(key)
+		m.set(shard, key, value)
 		shard.Unlock()
 	}
 }
@@ -98,12 +186,106 @@ func (m ConcurrentMap[K, V]) MSet(data map[K]V) {
 // 设置指定key下的给定值。
 func (m ConcurrentMap[K, V]) Set(key K, value V) {
 	// Get map shard.
-	shard := m.GetShard(key)
-	shard.Lock()
-	shard.items[key] = value
+	shard := m.lockShard(key)
+	m.set(shard, key, value)
 	shard.Unlock()
 }
 
+// set stores value under key in the locked shard with the default TTL and runs the hooks.
+//
+// set 以默认过期时间在已加锁的分片中存储值并执行回调
+func (m ConcurrentMap[K, V]) set(shard *ConcurrentMapShared[K, V], key K, value V) {
+	m.store(shard, key, value, m.state.defaultTTL)
+}
+
+// store stores value under key in the locked shard and runs the hooks.
+// A ttl <= 0 means the key never expires.
+//
+// store 在已加锁的分片中存储值并执行回调, ttl <= 0 表示永不过期
+func (m ConcurrentMap[K, V]) store(shard *ConcurrentMapShared[K, V], key K, value V, ttl time.Duration) {
+	var (
+		old V
+		ok  bool
+	)
+	hooks := m.hooks()
+	if hooks != nil && hooks.onSet {
+		old, ok = shard.peek(key)
+	}
+	shard.items[key] = value
+	if shard.stats != nil {
+		atomic.AddUint64(&shard.stats.sets, 1)
+	}
+	var deadline int64
+	if ttl > 0 {
+		if shard.expires == nil {
+			shard.expires = make(map[K]int64)
+		}
+		deadline = time.Now().Add(ttl).UnixNano()
+		shard.expires[key] = deadline
+		m.startJanitor()
+	} else if shard.expires != nil {
+		delete(shard.expires, key)
+	}
+	if w := m.state.wal; w != nil {
+		w.set(key, value, deadline)
+	}
+	if shard.lru != nil {
+		m.used(shard, key)
+	}
+	m.maybeGrow(shard)
+	if hooks != nil && hooks.onSet {
+		hooks.set(key, old, ok, value)
+	}
+	m.notify(EventSet, key, value)
+}
+
+// lookup returns the value of key in the locked shard, removing it if expired.
+//
+// lookup 返回已加锁分片中key的值, 已过期时将其删除
+func (m ConcurrentMap[K, V]) lookup(shard *ConcurrentMapShared[K, V], key K) (v V, ok bool) {
+	v, ok = shard.items[key]
+	if ok && shard.expiredNow(key) {
+		m.removeAs(shard, key, EventExpire)
+		var zero V
+		return zero, false
+	}
+	return v, ok
+}
+
+// remove deletes key from the locked shard and runs the hooks.
+//
+// remove 从已加锁的分片中删除key并执行回调
+func (m ConcurrentMap[K, V]) remove(shard *ConcurrentMapShared[K, V], key K) (v V, ok bool) {
+	return m.removeAs(shard, key, EventRemove)
+}
+
+// removeAs deletes key from the locked shard and runs the hooks, watchers
+// receive an event of type typ.
+//
+// removeAs 从已加锁的分片中删除key并执行回调, 订阅者收到类型为 typ 的事件
+func (m ConcurrentMap[K, V]) removeAs(shard *ConcurrentMapShared[K, V], key K, typ EventType) (v V, ok bool) {
+	v, ok = shard.items[key]
+	if !ok {
+		return v, false
+	}
+	delete(shard.items, key)
+	delete(shard.expires, key)
+	if shard.stats != nil {
+		atomic.AddUint64(&shard.stats.removes, 1)
+	}
+	if shard.lru != nil {
+		shard.lru.forget(key)
+	}
+	if w := m.state.wal; w != nil {
+		w.remove(key)
+	}
+	if hooks := m.hooks(); hooks != nil {
+		hooks.remove(key, v, typ)
+	}
+	m.notify(typ, key, v)
+	return v, true
+}
+
 // Callback to return new element to be inserted into the map
 // It is called while lock is held, therefore it MUST NOT
 // try to access other keys in same map, as it can lead to deadlock since
@@ -119,11 +301,10 @@ type UpsertCb[V any] func(exist bool, valueInMap V, newValue V) V
 //
 // Insert 或 Update - 使用 UpsertCb 更新现有元素或插入新元素
 func (m ConcurrentMap[K, V]) Upsert(key K, value V, cb UpsertCb[V]) (res V) {
-	shard := m.GetShard(key)
-	shard.Lock()
-	v, ok := shard.items[key]
+	shard := m.lockShard(key)
+	v, ok := m.lookup(shard, key)
 	res = cb(ok, v, value)
-	shard.items[key] = res
+	m.set(shard, key, res)
 	shard.Unlock()
 	return res
 }
@@ -133,11 +314,10 @@ func (m ConcurrentMap[K, V]) Upsert(key K, value V, cb UpsertCb[V]) (res V) {
 // 如果没有值与指定键关联，则在指定键下设置给定值。
 func (m ConcurrentMap[K, V]) SetIfAbsent(key K, value V) bool {
 	// Get map shard.
-	shard := m.GetShard(key)
-	shard.Lock()
-	_, ok := shard.items[key]
+	shard := m.lockShard(key)
+	_, ok := m.lookup(shard, key)
 	if !ok {
-		shard.items[key] = value
+		m.set(shard, key, value)
 	}
 	shard.Unlock()
 	return !ok
@@ -148,10 +328,21 @@ func (m ConcurrentMap[K, V]) SetIfAbsent(key K, value V) bool {
 // Get 从给定key下的映射中检索元素。
 func (m ConcurrentMap[K, V]) Get(key K) (V, bool) {
 	// Get shard
-	shard := m.GetShard(key)
-	shard.RLock()
+	shard := m.rlockShard(key)
 	// Get item from shard.
 	val, ok := shard.items[key]
+	if ok && shard.expiredNow(key) {
+		shard.countGet(false)
+		shard.RUnlock()
+		m.expire(key)
+		var zero V
+		return zero, false
+	}
+	shard.countGet(ok)
+	if ok && shard.lru != nil {
+		shard.recordRead(key)
+		return val, ok
+	}
 	shard.RUnlock()
 	return val, ok
 }
@@ -161,12 +352,10 @@ func (m ConcurrentMap[K, V]) Get(key K) (V, bool) {
 // Count返回map中元素的数量。
 func (m ConcurrentMap[K, V]) Count() int {
 	count := 0
-	for i := 0; i < SHARD_COUNT; i++ {
-		shard := m.shards[i]
-		shard.RLock()
-		count += len(shard.items)
-		shard.RUnlock()
-	}
+	m.walkAll(false, func(shard *ConcurrentMapShared[K, V]) bool {
+		count += len(shard.items) - shard.countExpired()
+		return true
+	})
 	return count
 }
 
@@ -175,10 +364,16 @@ func (m ConcurrentMap[K, V]) Count() int {
 // 查找指定key下的项目
 func (m ConcurrentMap[K, V]) Has(key K) bool {
 	// Get shard
-	shard := m.GetShard(key)
-	shard.RLock()
+	shard := m.rlockShard(key)
 	// See if element is within shard.
 	_, ok := shard.items[key]
+	if ok && shard.expiredNow(key) {
+		shard.countGet(false)
+		shard.RUnlock()
+		m.expire(key)
+		return false
+	}
+	shard.countGet(ok)
 	shard.RUnlock()
 	return ok
 }
@@ -188,9 +383,8 @@ func (m ConcurrentMap[K, V]) Has(key K) bool {
 // Remove 从map中移除指定元素
 func (m ConcurrentMap[K, V]) Remove(key K) {
 	// Try to get shard.
-	shard := m.GetShard(key)
-	shard.Lock()
-	delete(shard.items, key)
+	shard := m.lockShard(key)
+	m.remove(shard, key)
 	shard.Unlock()
 }
 
@@ -210,12 +404,11 @@ type RemoveCb[K any, V any] func(key K, v V, exists bool) bool
 // 返回回调返回的值（即使元素不在map中）
 func (m ConcurrentMap[K, V]) RemoveCb(key K, cb RemoveCb[K, V]) bool {
 	// Try to get shard.
-	shard := m.GetShard(key)
-	shard.Lock()
-	v, ok := shard.items[key]
+	shard := m.lockShard(key)
+	v, ok := m.lookup(shard, key)
 	remove := cb(key, v, ok)
 	if remove && ok {
-		delete(shard.items, key)
+		m.remove(shard, key)
 	}
 	shard.Unlock()
 	return remove
@@ -226,10 +419,11 @@ func (m ConcurrentMap[K, V]) RemoveCb(key K, cb RemoveCb[K, V]) bool {
 // Pop从map中删除元素并将其返回
 func (m ConcurrentMap[K, V]) Pop(key K) (v V, exists bool) {
 	// Try to get shard.
-	shard := m.GetShard(key)
-	shard.Lock()
-	v, exists = shard.items[key]
-	delete(shard.items, key)
+	shard := m.lockShard(key)
+	v, exists = m.lookup(shard, key)
+	if exists {
+		m.remove(shard, key)
+	}
 	shard.Unlock()
 	return v, exists
 }
@@ -255,9 +449,17 @@ type Tuple[K comparable, V any] struct {
 // Iter 返回一个迭代器，可以在for range循环中使用。
 // 不推荐：使用 IterBuffered() 将获得更好的性能
 func (m ConcurrentMap[K, V]) Iter() <-chan Tuple[K, V] {
-	chans := snapshot(m)
+	return m.IterContext(context.Background())
+}
+
+// IterContext is like Iter, but once ctx is done the channel is closed and
+// all goroutines started by the iterator exit, even if it is not drained.
+//
+// IterContext 与 Iter 相同, 但 ctx 结束后管道会被关闭, 即使没有读完, 迭代器启动的所有goroutine也会退出.
+func (m ConcurrentMap[K, V]) IterContext(ctx context.Context) <-chan Tuple[K, V] {
+	chans := snapshot(ctx, m)
 	ch := make(chan Tuple[K, V])
-	go fanIn(chans, ch)
+	go fanIn(ctx, chans, ch)
 	return ch
 }
 
@@ -265,13 +467,21 @@ func (m ConcurrentMap[K, V]) Iter() <-chan Tuple[K, V] {
 //
 // IterBuffered 返回一个缓冲迭代器，可以在for range循环中使用。
 func (m ConcurrentMap[K, V]) IterBuffered() <-chan Tuple[K, V] {
-	chans := snapshot(m)
+	return m.IterBufferedContext(context.Background())
+}
+
+// IterBufferedContext is like IterBuffered, but once ctx is done the channel
+// is closed and all goroutines started by the iterator exit.
+//
+// IterBufferedContext 与 IterBuffered 相同, 但 ctx 结束后管道会被关闭, 迭代器启动的所有goroutine都会退出.
+func (m ConcurrentMap[K, V]) IterBufferedContext(ctx context.Context) <-chan Tuple[K, V] {
+	chans := snapshot(ctx, m)
 	total := 0
 	for _, c := range chans {
 		total += cap(c)
 	}
 	ch := make(chan Tuple[K, V], total)
-	go fanIn(chans, ch)
+	go fanIn(ctx, chans, ch)
 	return ch
 }
 
@@ -288,48 +498,69 @@ func (m ConcurrentMap[K, V]) Clear() {
 // which likely takes a snapshot of `m`.
 // It returns once the size of each buffered channel is determined,
 // before all the channels are populated using goroutines.
+// Shards are copied before their read lock is released and the channels
+// are large enough, so the goroutines never block; shards not yet copied
+// when ctx is done are skipped.
 //
 // 返回一个管道数组，其中包含每个碎片中的元素，这可能会获取“m”的快照。
 // 在使用goroutine填充所有管道之前，一旦确定了每个缓冲管道的大小，它就会return。
-func snapshot[K comparable, V any](m ConcurrentMap[K, V]) (chans []chan Tuple[K, V]) {
+// 分片在释放读锁之前被复制, 且管道容量足够, 因此goroutine不会阻塞; ctx 结束时尚未复制的分片被跳过.
+func snapshot[K comparable, V any](ctx context.Context, m ConcurrentMap[K, V]) (chans []chan Tuple[K, V]) {
 	// When you access map items before initializing.
 	// 当访问映射时，初始化之前的项
-	if len(m.shards) == 0 {
+	if m.state == nil {
 		panic(`cmap.ConcurrentMap is not initialized. Should run New() before usage.`)
 	}
-	chans = make([]chan Tuple[K, V], SHARD_COUNT)
+	t := m.table()
+	chans = make([]chan Tuple[K, V], len(t.shards))
 	wg := sync.WaitGroup{}
-	wg.Add(SHARD_COUNT)
+	wg.Add(len(t.shards))
 	// Foreach shard.
-	for index, shard := range m.shards {
-		go func(index int, shard *ConcurrentMapShared[K, V]) {
+	for index := range t.shards {
+		go func(index int) {
 			// Foreach key, value pair.
-			shard.RLock()
-			chans[index] = make(chan Tuple[K, V], len(shard.items))
+			var items []Tuple[K, V]
+			walk(t, index, false, func(shard *ConcurrentMapShared[K, V]) bool {
+				if ctx.Err() != nil {
+					return false
+				}
+				now := time.Now().UnixNano()
+				for key, val := range shard.items {
+					if !shard.expired(key, now) {
+						items = append(items, Tuple[K, V]{key, val})
+					}
+				}
+				return true
+			})
+			chans[index] = make(chan Tuple[K, V], len(items))
 			wg.Done()
-			for key, val := range shard.items {
-				chans[index] <- Tuple[K, V]{key, val}
+			for _, item := range items {
+				chans[index] <- item
 			}
-			shard.RUnlock()
 			close(chans[index])
-		}(index, shard)
+		}(index)
 	}
 	wg.Wait()
 	return chans
 }
 
 // fanIn reads elements from channels `chans` into channel `out`
+// until they are drained or ctx is done.
 //
-// fanIn 将元素从管道 `chans` 读入管道 `out`
-func fanIn[K comparable, V any](chans []chan Tuple[K, V], out chan Tuple[K, V]) {
+// fanIn 将元素从管道 `chans` 读入管道 `out`, 直到读完或 ctx 结束
+func fanIn[K comparable, V any](ctx context.Context, chans []chan Tuple[K, V], out chan Tuple[K, V]) {
 	wg := sync.WaitGroup{}
 	wg.Add(len(chans))
 	for _, ch := range chans {
 		go func(ch chan Tuple[K, V]) {
+			defer wg.Done()
 			for t := range ch {
-				out <- t
+				select {
+				case out <- t:
+				case <-ctx.Done():
+					return
+				}
 			}
-			wg.Done()
 		}(ch)
 	}
 	wg.Wait()
@@ -350,6 +581,32 @@ func (m ConcurrentMap[K, V]) Items() map[K]V {
 	return tmp
 }
 
+// Snapshot returns a copy of all items that existed together at a single
+// point in time, unlike Items, which is only consistent per shard.
+// Writes are blocked while the copy is taken.
+//
+// Snapshot 返回在同一时刻共同存在的所有项目的副本, 而 Items 只保证单个分片的一致性.
+// 复制期间写操作被阻塞.
+func (m ConcurrentMap[K, V]) Snapshot() map[K]V {
+	var tmp map[K]V
+	m.frozen(func(shards []*ConcurrentMapShared[K, V]) {
+		size := 0
+		for _, shard := range shards {
+			size += len(shard.items)
+		}
+		tmp = make(map[K]V, size)
+		now := time.Now().UnixNano()
+		for _, shard := range shards {
+			for key, val := range shard.items {
+				if !shard.expired(key, now) {
+					tmp[key] = val
+				}
+			}
+		}
+	})
+	return tmp
+}
+
 // Iterator callbacalled for every key,value found in
 // maps. RLock is held for all calls for a given shard
 // therefore callback sess consistent view of a shard,
@@ -363,14 +620,33 @@ type IterCb[K comparable, V any] func(key K, v V)
 //
 // 基于回调的迭代器，读取map中所有元素的最简易方法
 func (m ConcurrentMap[K, V]) IterCb(fn IterCb[K, V]) {
-	for idx := range m.shards {
-		shard := (m.shards)[idx]
-		shard.RLock()
+	m.walkAll(false, func(shard *ConcurrentMapShared[K, V]) bool {
+		now := time.Now().UnixNano()
 		for key, value := range shard.items {
-			fn(key, value)
+			if !shard.expired(key, now) {
+				fn(key, value)
+			}
 		}
-		shard.RUnlock()
-	}
+		return true
+	})
+}
+
+// Range calls fn for every key, value pair until fn returns false.
+// Like IterCb, RLock is held for all calls for a given shard,
+// so fn MUST NOT write to the map.
+//
+// Range 对每个键值对调用 fn, 直到 fn 返回 false.
+// 与 IterCb 相同, 对给定分片的所有调用都持有 RLock, 因此 fn 不能写入该map.
+func (m ConcurrentMap[K, V]) Range(fn func(key K, v V) bool) {
+	m.walkAll(false, func(shard *ConcurrentMapShared[K, V]) bool {
+		now := time.Now().UnixNano()
+		for key, value := range shard.items {
+			if !shard.expired(key, now) && !fn(key, value) {
+				return false
+			}
+		}
+		return true
+	})
 }
 
 // Keys returns all keys as []string
@@ -381,18 +657,23 @@ func (m ConcurrentMap[K, V]) Keys() []K {
 	ch := make(chan K, count)
 	go func() {
 		// Foreach shard.
+		t := m.table()
 		wg := sync.WaitGroup{}
-		wg.Add(SHARD_COUNT)
-		for _, shard := range m.shards {
-			go func(shard *ConcurrentMapShared[K, V]) {
+		wg.Add(len(t.shards))
+		for index := range t.shards {
+			go func(index int) {
 				// Foreach key, value pair.
-				shard.RLock()
-				for key := range shard.items {
-					ch <- key
-				}
-				shard.RUnlock()
+				walk(t, index, false, func(shard *ConcurrentMapShared[K, V]) bool {
+					now := time.Now().UnixNano()
+					for key := range shard.items {
+						if !shard.expired(key, now) {
+							ch <- key
+						}
+					}
+					return true
+				})
 				wg.Done()
-			}(shard)
+			}(index)
 		}
 		wg.Wait()
 		close(ch)
@@ -424,37 +705,74 @@ func fnv32(key string) uint32 {
 }
 
 // Reviles ConcurrentMap "private" variables to json marshal.
+// Keys are encoded as in encoding/json: string kinds directly,
+// encoding.TextMarshaler keys via MarshalText and integer kinds as decimal
+// strings, and the object is sorted by encoded key, or as set by
+// WithCanonical or WithKeyOrder.
 //
 // 将 ConcurrentMap 序列化为json.
+// 键的编码方式与 encoding/json 相同: 字符串类型直接使用, encoding.TextMarshaler 调用 MarshalText,
+// 整数类型为十进制字符串, 对象按编码后的键排序, 或按 WithCanonical 或 WithKeyOrder 的设置排序.
 func (m ConcurrentMap[K, V]) MarshalJSON() ([]byte, error) {
-	// Create a temporary map, which will hold all item spread across shards.
-	// 创建一个临时map，它将保存所有分片上的项目
-	tmp := make(map[K]V)
-
-	// Insert items to temporary map.
-	// 将项目插入临时map
+	// Collect the items shard by shard, then sort them.
+	// 逐个分片收集项目, 然后排序
+	var items []Tuple[K, V]
 	for item := range m.IterBuffered() {
-		tmp[item.Key] = item.Val
+		items = append(items, item)
+	}
+	if ok, less := m.canonical(); ok {
+		if err := sortItems(items, less, jsonKey[K]); err != nil {
+			return nil, err
+		}
+	} else if err := sortEncoded(items, jsonKey[K]); err != nil {
+		return nil, err
 	}
-	return json.Marshal(tmp)
+	buf := bytes.Buffer{}
+	if err := writeJSONObject(&buf, m.codec(), items); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 // Reverse process of Marshal.
-//
-// 反序列化json
+// Keys are decoded as in encoding/json, see MarshalJSON.
+// Entries combine with existing ones as set by WithMergePolicy once the
+// whole input is decoded; null leaves the map unchanged.
+// A zero value map is initialized first.
+//
+// 反序列化json, 键的解码方式与 encoding/json 相同, 见 MarshalJSON.
+// 整个输入解码之后, 元素按照 WithMergePolicy 的设置与已有元素合并; null 不改变map.
+// 零值map会先被初始化.
 func (m *ConcurrentMap[K, V]) UnmarshalJSON(b []byte) (err error) {
-	tmp := make(map[K]V)
-
-	// Unmarshal into a single map.
-	// json反序列化到map
-	if err := json.Unmarshal(b, &tmp); err != nil {
+	var raw map[string]stdjson.RawMessage
+
+	// Unmarshal into a single map, decoding every entry before touching m.
+	// The object is split with encoding/json like in DecodeJSON, only the
+	// values are decoded with the codec.
+	// json反序列化到map, 在修改 m 之前解码所有元素.
+	// 与 DecodeJSON 相同, 对象由 encoding/json 拆分, 只有值使用编解码器解码.
+	if err := stdjson.Unmarshal(b, &raw); err != nil {
 		return err
 	}
+	if raw == nil {
+		// null is a no-op, like in encoding/json.
+		// 与 encoding/json 相同, null 不做任何事
+		return nil
+	}
+	tmp := make([]Tuple[K, V], 0, len(raw))
+	for name, data := range raw {
+		key, err := decodeKey[K](name)
+		if err != nil {
+			return err
+		}
+		var val V
+		if err := m.codec().Unmarshal(data, &val); err != nil {
+			return err
+		}
+		tmp = append(tmp, Tuple[K, V]{key, val})
+	}
 
 	// foreach key,value pair in temporary map insert into our concurrent map.
 	// 临时map中的值对插入到并发map中。
-	for key, val := range tmp {
-		m.Set(key, val)
-	}
-	return nil
+	return m.mergeAll(tmp, nil)
 }
@@ -1,6 +1,8 @@
 package cmap
 
 import (
+	"hash/maphash"
+	"io"
 	"strconv"
 	"sync"
 	"testing"
@@ -388,3 +390,141 @@ func BenchmarkKeys(b *testing.B) {
 		m.Keys()
 	}
 }
+
+func BenchmarkCowMultiGetSame(b *testing.B) {
+	m := NewCow[string]()
+	m.Set("key", "value")
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.Get("key")
+		}
+	})
+}
+
+func BenchmarkMultiGetSameParallel(b *testing.B) {
+	m := New[string]()
+	m.Set("key", "value")
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.Get("key")
+		}
+	})
+}
+
+func BenchmarkCowSet(b *testing.B) {
+	m := NewCow[int]()
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(strconv.Itoa(i%1000), i)
+	}
+}
+
+func BenchmarkFnv32(b *testing.B) {
+	key := "github.com/Coloured-glaze/cmap"
+	for i := 0; i < b.N; i++ {
+		fnv32(key)
+	}
+}
+
+func BenchmarkComparableHashString(b *testing.B) {
+	hash := comparableHash[string](maphash.MakeSeed())
+	key := "github.com/Coloured-glaze/cmap"
+	for i := 0; i < b.N; i++ {
+		hash(key)
+	}
+}
+
+func BenchmarkComparableHashStruct(b *testing.B) {
+	hash := comparableHash[point](maphash.MakeSeed())
+	key := point{1, 2, "github.com/Coloured-glaze/cmap"}
+	for i := 0; i < b.N; i++ {
+		hash(key)
+	}
+}
+
+func BenchmarkItemsComparable(b *testing.B) {
+	m := NewComparable[uint32, Animal]()
+
+	// Insert 100 elements.
+	for i := 0; i < 10000; i++ {
+		m.Set((uint32)(i), Animal{strconv.Itoa(i)})
+	}
+	for i := 0; i < b.N; i++ {
+		m.Items()
+	}
+}
+
+func BenchmarkGetStringerKey(b *testing.B) {
+	m := NewStringer[userKey, int]()
+	key := userKey{1, 2}
+	m.Set(key, 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(key)
+	}
+}
+
+func BenchmarkGetHasherKey(b *testing.B) {
+	m := NewHasher[userKey, int]()
+	key := userKey{1, 2}
+	m.Set(key, 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(key)
+	}
+}
+
+func BenchmarkItemsNewInt(b *testing.B) {
+	m := NewInt[uint32, Animal]()
+
+	// Insert 100 elements.
+	for i := 0; i < 10000; i++ {
+		m.Set((uint32)(i), Animal{strconv.Itoa(i)})
+	}
+	for i := 0; i < b.N; i++ {
+		m.Items()
+	}
+}
+
+func BenchmarkIntHash(b *testing.B) {
+	hash := intHash[uint64](randomSeed())
+	for i := 0; i < b.N; i++ {
+		hash(uint64(i))
+	}
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	m := New[Animal]()
+
+	// Insert 100 elements.
+	for i := 0; i < 10000; i++ {
+		m.Set(strconv.Itoa(i), Animal{strconv.Itoa(i)})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = m.EncodeJSON(io.Discard)
+	}
+}
+
+func BenchmarkGetSetStats(b *testing.B) {
+	m, _ := NewWithOptions[string, int](WithStats())
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := strconv.Itoa(i % 1000)
+			if i%4 == 0 {
+				m.Set(key, i)
+			} else {
+				m.Get(key)
+			}
+			i++
+		}
+	})
+}
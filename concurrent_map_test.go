@@ -1,10 +1,14 @@
 package cmap
 
 import (
+	"context"
+	"encoding/json"
 	"hash/fnv"
+	"runtime"
 	"sort"
 	"strconv"
 	"testing"
+	"time"
 )
 
 type Animal struct {
@@ -13,7 +17,7 @@ type Animal struct {
 
 func TestMapCreation(t *testing.T) {
 	m := New[string]()
-	if m.shards == nil {
+	if m.state == nil {
 		t.Error("map is null.")
 	}
 
@@ -22,6 +26,33 @@ func TestMapCreation(t *testing.T) {
 	}
 }
 
+func TestShardCount(t *testing.T) {
+	m := NewWithShardCount[int](4)
+	if m.ShardCount() != 4 || len(m.table().shards) != 4 {
+		t.Error("map should have exactly 4 shards.")
+	}
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+
+	// Changing the default must not affect existing maps.
+	SHARD_COUNT = 7
+	defer func() {
+		SHARD_COUNT = 32
+	}()
+	for i := 0; i < 100; i++ {
+		if v, ok := m.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Error("lookup failed after SHARD_COUNT changed.")
+		}
+	}
+	if m.Count() != 100 || len(m.Keys()) != 100 || len(m.Items()) != 100 {
+		t.Error("We should have counted 100 elements.")
+	}
+	if New[int]().ShardCount() != 7 {
+		t.Error("New should use SHARD_COUNT as default.")
+	}
+}
+
 func TestInsert(t *testing.T) {
 	m := New[Animal]()
 	elephant := Animal{"elephant"}
@@ -343,6 +374,34 @@ func TestIterCb(t *testing.T) {
 	}
 }
 
+func TestRange(t *testing.T) {
+	m := New[Animal]()
+
+	// Insert 100 elements.
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), Animal{strconv.Itoa(i)})
+	}
+
+	counter := 0
+	// Iterate over elements.
+	m.Range(func(key string, v Animal) bool {
+		counter++
+		return true
+	})
+	if counter != 100 {
+		t.Error("We should have counted 100 elements.")
+	}
+
+	counter = 0
+	m.Range(func(key string, v Animal) bool {
+		counter++
+		return counter < 42
+	})
+	if counter != 42 {
+		t.Error("We should have been right where we stopped")
+	}
+}
+
 func TestItems(t *testing.T) {
 	m := New[Animal]()
 
@@ -358,6 +417,52 @@ func TestItems(t *testing.T) {
 	}
 }
 
+func TestSnapshot(t *testing.T) {
+	m := New[int]()
+	// Keys "a" and "b" are moved together, a consistent snapshot always holds
+	// exactly one of them.
+	m.Set("a", 0)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			from, to := "a", "b"
+			if i%2 == 0 {
+				from, to = to, from
+			}
+			// Lock both shards in table order, like Snapshot does.
+			first, second := m.GetShard("a"), m.GetShard("b")
+			if fnv32("a")%32 > fnv32("b")%32 {
+				first, second = second, first
+			}
+			first.Lock()
+			if second != first {
+				second.Lock()
+			}
+			delete(m.GetShard(from).items, from)
+			m.GetShard(to).items[to] = i
+			if second != first {
+				second.Unlock()
+			}
+			first.Unlock()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if items := m.Snapshot(); len(items) != 1 {
+			t.Error("snapshot is not consistent:", items)
+			break
+		}
+	}
+	close(stop)
+	<-done
+}
+
 func TestConcurrent(t *testing.T) {
 	m := New[int]()
 	ch := make(chan int)
@@ -640,3 +745,38 @@ func TestUnDrainedIterBuffered(t *testing.T) {
 		t.Error("We should have counted 200 elements.")
 	}
 }
+
+func TestIterContextNoLeak(t *testing.T) {
+	m := New[Animal]()
+	// Insert 100 elements.
+	Total := 100
+	for i := 0; i < Total; i++ {
+		m.Set(strconv.Itoa(i), Animal{strconv.Itoa(i)})
+	}
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := m.IterContext(ctx)
+	for i := 0; i < 42; i++ {
+		<-ch
+	}
+	bch := m.IterBufferedContext(ctx)
+	<-bch
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Error("iterator goroutines leaked:", n-goroutines)
+	}
+
+	// The map must still be writable, no read lock is left behind.
+	for i := Total; i < 2*Total; i++ {
+		m.Set(strconv.Itoa(i), Animal{strconv.Itoa(i)})
+	}
+	if m.Count() != 2*Total {
+		t.Error("We should have counted 200 elements.")
+	}
+}
@@ -0,0 +1,273 @@
+package cmap
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+// A read-optimized "thread" safe map for read-mostly data such as
+// configuration or routing tables. The map of each shard is published
+// through an atomic pointer, so Get and Has take no lock; writers copy
+// the shard map, modify the copy and publish it. Writes cost O(shard size).
+//
+// 一个为读多写少的数据(例如配置或路由表)优化的 "线程" 安全map.
+// 每个分片的map通过原子指针发布, 因此 Get 和 Has 不加锁; 写操作复制分片map, 修改副本后再发布.
+// 写操作的开销为 O(分片大小).
+type CowMap[K comparable, V any] struct {
+	shards   []*cowShard[K, V]  // map分片
+	sharding func(key K) uint32 // 分片
+}
+
+// cowShard is a shard of CowMap.
+//
+// cowShard 是 CowMap 的分片
+type cowShard[K comparable, V any] struct {
+	items atomic.Value // 当前发布的只读map, 类型为 map[K]V
+	mu    sync.Mutex   // 串行化写操作
+}
+
+// Creates a new copy-on-write map.
+//
+// 创建新的写时复制map
+func createCow[K comparable, V any](shardCount int, sharding func(key K) uint32) CowMap[K, V] {
+	if shardCount <= 0 {
+		panic(`cmap: shard count must be positive`)
+	}
+	m := CowMap[K, V]{
+		shards:   make([]*cowShard[K, V], shardCount),
+		sharding: sharding,
+	}
+	for i := range m.shards {
+		m.shards[i] = &cowShard[K, V]{}
+		items := make(map[K]V)
+		m.shards[i].items.Store(items)
+	}
+	return m
+}
+
+// Creates a new copy-on-write map. Keys are hashed as in NewSeeded.
+//
+// 创建新的写时复制map, key的哈希方式与 NewSeeded 相同
+func NewCow[V any]() CowMap[string, V] {
+	return createCow[string, V](SHARD_COUNT, seededHash(maphash.MakeSeed()))
+}
+
+// Creates a new copy-on-write map. The String of keys is hashed with a
+// random seed per map.
+//
+// 创建新的写时复制map, key的 String 结果使用每个map不同的随机种子哈希
+func NewCowStringer[K Stringer, V any]() CowMap[K, V] {
+	return createCow[K, V](SHARD_COUNT, seededStringerHash[K](maphash.MakeSeed()))
+}
+
+// Creates a new copy-on-write map.
+//
+// 创建新的写时复制map
+func NewCowWithCustomShardingFunction[K comparable, V any](sharding func(key K) uint32) CowMap[K, V] {
+	return createCow[K, V](SHARD_COUNT, sharding)
+}
+
+// getShard returns shard under given key
+//
+// getShard 返回给定key下的map分片
+func (m CowMap[K, V]) getShard(key K) *cowShard[K, V] {
+	return m.shards[uint(m.sharding(key))%uint(len(m.shards))]
+}
+
+// load returns the published map of the shard, it MUST NOT be modified.
+//
+// load 返回分片当前发布的map, 不能修改它
+func (s *cowShard[K, V]) load() map[K]V {
+	return s.items.Load().(map[K]V)
+}
+
+// update publishes a modified copy of the shard map. fn is called with the
+// copy while the writer lock is held.
+//
+// update 发布修改后的分片map副本. fn 在持有写锁时以副本为参数被调用.
+func (s *cowShard[K, V]) update(fn func(items map[K]V)) {
+	s.mu.Lock()
+	old := s.load()
+	items := make(map[K]V, len(old)+1)
+	for key, val := range old {
+		items[key] = val
+	}
+	fn(items)
+	s.items.Store(items)
+	s.mu.Unlock()
+}
+
+// ShardCount returns the number of shards of the map.
+//
+// ShardCount 返回map的分片数量
+func (m CowMap[K, V]) ShardCount() int {
+	return len(m.shards)
+}
+
+// Get retrieves an element from map under given key without locking.
+//
+// Get 从给定key下的映射中检索元素, 不加锁.
+func (m CowMap[K, V]) Get(key K) (V, bool) {
+	val, ok := m.getShard(key).load()[key]
+	return val, ok
+}
+
+// Looks up an item under specified key without locking.
+//
+// 查找指定key下的项目, 不加锁.
+func (m CowMap[K, V]) Has(key K) bool {
+	_, ok := m.getShard(key).load()[key]
+	return ok
+}
+
+// Sets the given value under the specified key.
+//
+// 设置指定key下的给定值。
+func (m CowMap[K, V]) Set(key K, value V) {
+	m.getShard(key).update(func(items map[K]V) {
+		items[key] = value
+	})
+}
+
+// MSet sets all given values, copying each shard at most once.
+//
+// MSet 设置所有给定的值, 每个分片最多复制一次.
+func (m CowMap[K, V]) MSet(data map[K]V) {
+	byShard := make(map[*cowShard[K, V]]map[K]V)
+	for key, value := range data {
+		shard := m.getShard(key)
+		if byShard[shard] == nil {
+			byShard[shard] = make(map[K]V)
+		}
+		byShard[shard][key] = value
+	}
+	for shard, values := range byShard {
+		shard.update(func(items map[K]V) {
+			for key, value := range values {
+				items[key] = value
+			}
+		})
+	}
+}
+
+// Sets the given value under the specified key if no value was associated with it.
+//
+// 如果没有值与指定键关联，则在指定键下设置给定值。
+func (m CowMap[K, V]) SetIfAbsent(key K, value V) bool {
+	shard := m.getShard(key)
+	if _, ok := shard.load()[key]; ok {
+		return false
+	}
+	set := false
+	shard.update(func(items map[K]V) {
+		if _, ok := items[key]; !ok {
+			items[key] = value
+			set = true
+		}
+	})
+	return set
+}
+
+// Insert or Update - updates existing element or inserts a new one using UpsertCb
+//
+// Insert 或 Update - 使用 UpsertCb 更新现有元素或插入新元素
+func (m CowMap[K, V]) Upsert(key K, value V, cb UpsertCb[V]) (res V) {
+	m.getShard(key).update(func(items map[K]V) {
+		v, ok := items[key]
+		res = cb(ok, v, value)
+		items[key] = res
+	})
+	return res
+}
+
+// Remove removes an element from the map.
+//
+// Remove 从map中移除指定元素
+func (m CowMap[K, V]) Remove(key K) {
+	m.Pop(key)
+}
+
+// Pop removes an element from the map and returns it
+//
+// Pop从map中删除元素并将其返回
+func (m CowMap[K, V]) Pop(key K) (v V, exists bool) {
+	shard := m.getShard(key)
+	if _, ok := shard.load()[key]; !ok {
+		return v, false
+	}
+	shard.update(func(items map[K]V) {
+		v, exists = items[key]
+		delete(items, key)
+	})
+	return v, exists
+}
+
+// Count returns the number of elements within the map.
+//
+// Count返回map中元素的数量。
+func (m CowMap[K, V]) Count() int {
+	count := 0
+	for _, shard := range m.shards {
+		count += len(shard.load())
+	}
+	return count
+}
+
+// IsEmpty checks if map is empty.
+//
+// IsEmpty检查map是否为空。
+func (m CowMap[K, V]) IsEmpty() bool {
+	return m.Count() == 0
+}
+
+// Range calls fn for every key, value pair until fn returns false.
+// No lock is held, fn sees a consistent view of a shard, but not across the shards.
+//
+// Range 对每个键值对调用 fn, 直到 fn 返回 false.
+// 不持有锁, fn 会获得分片的一致视图, 但不会跨越分片.
+func (m CowMap[K, V]) Range(fn func(key K, v V) bool) {
+	for _, shard := range m.shards {
+		for key, val := range shard.load() {
+			if !fn(key, val) {
+				return
+			}
+		}
+	}
+}
+
+// Items returns all items as map[K]V
+//
+// Items 将所有项目返回为 map[K]V
+func (m CowMap[K, V]) Items() map[K]V {
+	tmp := make(map[K]V)
+	m.Range(func(key K, v V) bool {
+		tmp[key] = v
+		return true
+	})
+	return tmp
+}
+
+// Keys returns all keys as []K
+//
+// Keys 将所有key返回 []K
+func (m CowMap[K, V]) Keys() []K {
+	keys := make([]K, 0, m.Count())
+	m.Range(func(key K, _ V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Clear removes all items from map.
+//
+// Clear 将从map中删除所有项目。
+func (m CowMap[K, V]) Clear() {
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		items := make(map[K]V)
+		shard.items.Store(items)
+		shard.mu.Unlock()
+	}
+}
@@ -0,0 +1,69 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCowMap(t *testing.T) {
+	m := NewCow[Animal]()
+	elephant := Animal{"elephant"}
+	monkey := Animal{"monkey"}
+
+	m.Set("elephant", elephant)
+	m.MSet(map[string]Animal{"monkey": monkey, "tiger": {"tiger"}})
+	if m.Count() != 3 {
+		t.Error("map should contain exactly three elements.")
+	}
+	if v, ok := m.Get("elephant"); !ok || v != elephant {
+		t.Error("ok should be true for item stored within the map.")
+	}
+	if m.SetIfAbsent("elephant", monkey) {
+		t.Error("map set a new value even the entry is already present")
+	}
+	if v, ok := m.Pop("monkey"); !ok || v != monkey {
+		t.Error("Pop didn't find a monkey.")
+	}
+	if m.Has("monkey") {
+		t.Error("element shouldn't exists")
+	}
+	res := m.Upsert("tiger", Animal{"lion"}, func(exist bool, valueInMap Animal, newValue Animal) Animal {
+		valueInMap.name += newValue.name
+		return valueInMap
+	})
+	if res.name != "tigerlion" {
+		t.Error("Upsert failed")
+	}
+	m.Remove("tiger")
+	if len(m.Keys()) != 1 || len(m.Items()) != 1 {
+		t.Error("map should contain exactly one element.")
+	}
+	m.Clear()
+	if !m.IsEmpty() {
+		t.Error("We should have 0 elements.")
+	}
+}
+
+func TestCowMapConcurrent(t *testing.T) {
+	m := NewCowWithCustomShardingFunction[uint32, int](directSharding)
+	wg := sync.WaitGroup{}
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 250; i++ {
+				m.Set(uint32(w*250+i), i)
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Get(uint32(i))
+			}
+		}()
+	}
+	wg.Wait()
+	if m.Count() != 1000 {
+		t.Error("Expecting 1000 elements.")
+	}
+}
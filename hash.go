@@ -0,0 +1,153 @@
+package cmap
+
+import (
+	"fmt"
+	"hash/maphash"
+)
+
+// HashMode selects how NewWithOptions hashes keys by default.
+//
+// HashMode 选择 NewWithOptions 默认的key哈希方式
+type HashMode int
+
+const (
+	// HashSeeded hashes keys with a random seed per map, so crafted keys
+	// cannot pile up in one shard. It is the default.
+	//
+	// HashSeeded 使用每个map不同的随机种子哈希key, 因此精心构造的key无法堆积在同一个分片中. 这是默认值.
+	HashSeeded HashMode = iota
+	// HashFnv32 hashes string and Stringer keys with the unseeded fnv32,
+	// like New and NewStringer. Placement is predictable across processes.
+	//
+	// HashFnv32 与 New 和 NewStringer 相同, 使用不带种子的 fnv32 哈希 string 和 Stringer 类型的key, 分片位置在不同进程间可预测.
+	HashFnv32
+)
+
+// WithHashMode sets how keys are hashed when no WithSharding is given.
+//
+// WithHashMode 设置未使用 WithSharding 时key的哈希方式
+func WithHashMode(mode HashMode) Option {
+	return func(o *options) {
+		o.hashMode = mode
+	}
+}
+
+// Creates a new concurrent map whose string keys are hashed with a random
+// seed per map, which resists hash flooding by keys an attacker controls.
+//
+// 创建新的并发map, 其string类型的key使用每个map不同的随机种子哈希, 可以抵御攻击者控制key时的哈希洪水攻击.
+func NewSeeded[V any]() ConcurrentMap[string, V] {
+	return create[string, V](SHARD_COUNT, seededHash(maphash.MakeSeed()), &mapState[string, V]{})
+}
+
+// seededHash returns a sharding function hashing strings with seed.
+//
+// seededHash 返回使用 seed 哈希字符串的分片函数
+func seededHash(seed maphash.Seed) func(key string) uint32 {
+	return func(key string) uint32 {
+		return stringHash(seed, key)
+	}
+}
+
+// seededStringerHash returns a sharding function hashing the String of keys with seed.
+//
+// seededStringerHash 返回使用 seed 哈希key的 String 结果的分片函数
+func seededStringerHash[K fmt.Stringer](seed maphash.Seed) func(key K) uint32 {
+	return func(key K) uint32 {
+		return stringHash(seed, key.String())
+	}
+}
+
+// stringHash hashes s with seed. maphash.String is only available since Go 1.19.
+//
+// stringHash 使用 seed 哈希 s. maphash.String 从 Go 1.19 起才提供.
+func stringHash(seed maphash.Seed, s string) uint32 {
+	var h maphash.Hash
+	h.SetSeed(seed)
+	h.WriteString(s)
+	return fold(h.Sum64())
+}
+
+// Creates a new concurrent map for any comparable key type.
+// Keys are hashed with hash/maphash using a random seed per map.
+//
+// 为任意可比较的key类型创建新的并发map.
+// key使用 hash/maphash 哈希, 每个map使用不同的随机种子.
+func NewComparable[K comparable, V any]() ConcurrentMap[K, V] {
+	return create[K, V](SHARD_COUNT, comparableHash[K](maphash.MakeSeed()), &mapState[K, V]{})
+}
+
+// Hasher is implemented by key types that hash themselves, so they are
+// sharded without converting them to a string as NewStringer does.
+// Equal keys MUST return equal hashes.
+//
+// Hasher 由自行计算哈希的key类型实现, 因此分片时无需像 NewStringer 那样将其转换为字符串.
+// 相等的key必须返回相同的哈希.
+type Hasher interface {
+	comparable
+	Hash() uint64
+}
+
+// Creates a new concurrent map whose keys are sharded by their Hash method,
+// without allocating.
+//
+// 创建新的并发map, 其key通过 Hash 方法分片, 不分配内存.
+func NewHasher[K Hasher, V any]() ConcurrentMap[K, V] {
+	return create[K, V](SHARD_COUNT, hasherHash[K], &mapState[K, V]{})
+}
+
+func hasherHash[K Hasher](key K) uint32 {
+	return fold(key.Hash())
+}
+
+// Integral is the set of integer key types supported by NewInt.
+//
+// Integral 是 NewInt 支持的整数key类型集合
+type Integral interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Creates a new concurrent map with integer keys. Keys are mixed with a
+// seeded 64 bit finalizer, so sequential IDs spread evenly over shards.
+//
+// 创建key为整数的新并发map. key经过带种子的64位混合函数处理, 因此连续的ID会均匀分布到各个分片.
+func NewInt[K Integral, V any]() ConcurrentMap[K, V] {
+	return create[K, V](SHARD_COUNT, intHash[K](randomSeed()), &mapState[K, V]{})
+}
+
+// intHash returns a sharding function mixing integer keys with seed.
+//
+// intHash 返回使用 seed 混合整数key的分片函数
+func intHash[K Integral](seed uint64) func(key K) uint32 {
+	return func(key K) uint32 {
+		return fold(mix64(uint64(key) ^ seed))
+	}
+}
+
+// mix64 is the splitmix64 finalizer, every input bit affects every output bit.
+//
+// mix64 是 splitmix64 的最终混合函数, 每个输入位都会影响每个输出位
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// randomSeed returns a random 64 bit seed.
+//
+// randomSeed 返回一个随机的64位种子
+func randomSeed() uint64 {
+	var h maphash.Hash
+	return h.Sum64()
+}
+
+// fold folds a 64 bit hash into 32 bits.
+//
+// fold 将64位哈希折叠为32位
+func fold(h uint64) uint32 {
+	return uint32(h ^ h>>32)
+}
@@ -0,0 +1,89 @@
+//go:build !go1.24
+
+package cmap
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"reflect"
+)
+
+// comparableHash returns a sharding function hashing any comparable key with seed.
+// maphash.Comparable is only available since Go 1.24, so the key is walked
+// with reflection: equal keys always produce equal hashes.
+//
+// comparableHash 返回使用 seed 哈希任意可比较key的分片函数.
+// maphash.Comparable 从 Go 1.24 起才提供, 因此这里通过反射遍历key: 相等的key总是产生相同的哈希.
+func comparableHash[K comparable](seed maphash.Seed) func(key K) uint32 {
+	return func(key K) uint32 {
+		var h maphash.Hash
+		h.SetSeed(seed)
+		writeValue(&h, reflect.ValueOf(&key).Elem())
+		return fold(h.Sum64())
+	}
+}
+
+// writeValue writes the comparable value v to h.
+//
+// writeValue 将可比较的值 v 写入 h
+func writeValue(h *maphash.Hash, v reflect.Value) {
+	var buf [8]byte
+	switch v.Kind() {
+	case reflect.String:
+		h.WriteString(v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			h.WriteByte(1)
+		} else {
+			h.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Int()))
+		h.Write(buf[:])
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		binary.LittleEndian.PutUint64(buf[:], v.Uint())
+		h.Write(buf[:])
+	case reflect.Float32, reflect.Float64:
+		writeFloat(h, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeFloat(h, real(c))
+		writeFloat(h, imag(c))
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Pointer()))
+		h.Write(buf[:])
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			writeValue(h, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			// Blank fields are ignored by ==, so they must not be hashed.
+			// 比较时忽略空白字段, 因此不能对其哈希.
+			if v.Type().Field(i).Name == "_" {
+				continue
+			}
+			writeValue(h, v.Field(i))
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			h.WriteByte(0)
+			return
+		}
+		h.WriteString(v.Elem().Type().String())
+		writeValue(h, v.Elem())
+	}
+}
+
+// writeFloat writes f to h, +0 and -0 are equal and hash the same.
+//
+// writeFloat 将 f 写入 h, +0 和 -0 相等, 因此哈希相同
+func writeFloat(h *maphash.Hash, f float64) {
+	if f == 0 {
+		f = 0
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+	h.Write(buf[:])
+}
@@ -0,0 +1,16 @@
+//go:build go1.24
+
+package cmap
+
+import (
+	"hash/maphash"
+)
+
+// comparableHash returns a sharding function hashing any comparable key with seed.
+//
+// comparableHash 返回使用 seed 哈希任意可比较key的分片函数
+func comparableHash[K comparable](seed maphash.Seed) func(key K) uint32 {
+	return func(key K) uint32 {
+		return fold(maphash.Comparable(seed, key))
+	}
+}
@@ -0,0 +1,197 @@
+package cmap
+
+import (
+	"hash/maphash"
+	"strconv"
+	"testing"
+	"unsafe"
+)
+
+type point struct {
+	x, y int
+	tag  string
+}
+
+func TestNewComparable(t *testing.T) {
+	m := NewComparable[point, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(point{i, -i, "p"}, i)
+	}
+	if m.Count() != 100 {
+		t.Error("Expecting 100 element within map.")
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := m.Get(point{i, -i, "p"}); !ok || v != i {
+			t.Error("missing value", i)
+		}
+	}
+
+	a := NewComparable[[2]int64, int]()
+	a.Set([2]int64{1, 2}, 3)
+	if !a.Has([2]int64{1, 2}) || a.Has([2]int64{2, 1}) {
+		t.Error("array keys are not looked up correctly")
+	}
+}
+
+func TestComparableHashFloat(t *testing.T) {
+	hash := comparableHash[float64](maphash.MakeSeed())
+	zero := 0.0
+	if hash(zero) != hash(-zero) {
+		t.Error("+0 and -0 are equal keys and must hash the same")
+	}
+}
+
+func TestComparableHashBlank(t *testing.T) {
+	type padded struct {
+		x int
+		_ int
+	}
+	hash := comparableHash[padded](maphash.MakeSeed())
+	a, b := padded{x: 1}, padded{x: 1}
+	// Blank fields cannot be assigned, but may hold any value.
+	*(*int)(unsafe.Add(unsafe.Pointer(&b), unsafe.Sizeof(0))) = 2
+	if a != b || hash(a) != hash(b) {
+		t.Error("keys differing only in blank fields are equal and must hash the same")
+	}
+}
+
+func TestComparableHashSpread(t *testing.T) {
+	m := NewComparable[int, int]()
+	for i := 0; i < 32*100; i++ {
+		m.Set(i, i)
+	}
+	for _, shard := range m.table().shards {
+		if len(shard.items) == 0 {
+			t.Error("sequential keys should spread over all shards")
+		}
+	}
+}
+
+type userKey struct {
+	tenant uint32
+	id     uint64
+}
+
+func (k userKey) Hash() uint64 {
+	return (uint64(k.tenant)<<32 ^ k.id) * 0x9E3779B97F4A7C15
+}
+
+func (k userKey) String() string {
+	return strconv.FormatUint(uint64(k.tenant), 10) + "/" + strconv.FormatUint(k.id, 10)
+}
+
+func TestNewHasher(t *testing.T) {
+	m := NewHasher[userKey, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(userKey{uint32(i % 3), uint64(i)}, i)
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := m.Get(userKey{uint32(i % 3), uint64(i)}); !ok || v != i {
+			t.Error("missing value", i)
+		}
+	}
+
+	key := userKey{1, 2}
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Set(key, 1)
+		m.Get(key)
+		m.Has(key)
+	})
+	if allocs != 0 {
+		t.Error("Hasher keys should not allocate, got", allocs)
+	}
+
+	o, err := NewWithOptions[userKey, int]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Set(key, 1)
+	if o.GetShard(key) != o.table().shards[hasherHash(key)%uint32(SHARD_COUNT)] {
+		t.Error("NewWithOptions should prefer the Hash method")
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		o.Set(key, 1)
+		o.Get(key)
+		o.Has(key)
+	})
+	if allocs != 0 {
+		t.Error("Hasher keys of NewWithOptions should not allocate, got", allocs)
+	}
+}
+
+func TestSeededHash(t *testing.T) {
+	// Keys crafted to collide in one shard under the unseeded fnv32.
+	var keys []string
+	for i := 0; len(keys) < 320; i++ {
+		key := strconv.Itoa(i)
+		if fnv32(key)%uint32(SHARD_COUNT) == 0 {
+			keys = append(keys, key)
+		}
+	}
+
+	m := NewSeeded[int]()
+	for i, key := range keys {
+		m.Set(key, i)
+	}
+	for _, shard := range m.table().shards {
+		if len(shard.items) == len(keys) {
+			t.Error("crafted keys should not pile up in one shard")
+		}
+	}
+	for i, key := range keys {
+		if v, ok := m.Get(key); !ok || v != i {
+			t.Error("missing value", key)
+		}
+	}
+
+	c := NewCow[int]()
+	s := NewCowStringer[Integer, int]()
+	for i, key := range keys {
+		c.Set(key, i)
+		n, _ := strconv.Atoi(key)
+		s.Set(Integer(n), i)
+	}
+	for i := range c.shards {
+		if len(c.shards[i].load()) == len(keys) || len(s.shards[i].load()) == len(keys) {
+			t.Error("crafted keys should not pile up in one shard of a CowMap")
+		}
+	}
+
+	f, err := NewWithOptions[string, int](WithHashMode(HashFnv32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		f.Set(key, 0)
+	}
+	if len(f.table().shards[0].items) != len(keys) {
+		t.Error("HashFnv32 should hash keys with fnv32")
+	}
+}
+
+type userID uint32
+
+func TestNewInt(t *testing.T) {
+	m := NewInt[userID, int]()
+	const perShard = 1000
+	total := SHARD_COUNT * perShard
+	for i := 0; i < total; i++ {
+		m.Set(userID(i), i)
+	}
+	for _, shard := range m.table().shards {
+		if n := len(shard.items); n < perShard*8/10 || n > perShard*12/10 {
+			t.Error("sequential keys should spread evenly, got", n)
+		}
+	}
+	for i := 0; i < total; i++ {
+		if v, ok := m.Get(userID(i)); !ok || v != i {
+			t.Error("missing value", i)
+		}
+	}
+
+	n := NewInt[int8, int]()
+	n.Set(-1, 1)
+	if !n.Has(-1) || n.Has(1) {
+		t.Error("negative keys are not looked up correctly")
+	}
+}
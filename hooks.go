@@ -0,0 +1,96 @@
+package cmap
+
+import "sync"
+
+// hookSet is an immutable set of registered hooks.
+//
+// hookSet 是已注册回调的不可变集合
+type hookSet[K comparable, V any] struct {
+	all   []*Hooks[K, V]
+	onSet bool // 是否有回调设置了 OnSet
+}
+
+// AddHooks registers hooks on the map, and returns a function that
+// unregisters them. Hooks registered on any copy of the map apply to all
+// copies. Mutations running concurrently with AddHooks may miss the new hooks.
+//
+// AddHooks 在map上注册回调, 并返回一个注销它们的函数. 在map任意副本上注册的回调对所有副本生效.
+// 与 AddHooks 并发执行的修改可能不会调用新的回调.
+func (m ConcurrentMap[K, V]) AddHooks(hooks Hooks[K, V]) (remove func()) {
+	if hooks.OnSet == nil && hooks.OnRemove == nil && hooks.OnEvict == nil {
+		return func() {}
+	}
+	h := &hooks
+	m.updateHooks(func(all []*Hooks[K, V]) []*Hooks[K, V] {
+		return append(all, h)
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.updateHooks(func(all []*Hooks[K, V]) []*Hooks[K, V] {
+				for i, x := range all {
+					if x == h {
+						return append(all[:i], all[i+1:]...)
+					}
+				}
+				return all
+			})
+		})
+	}
+}
+
+// hooks returns the registered hooks, nil if there are none.
+//
+// hooks 返回已注册的回调, 没有时返回 nil
+func (m ConcurrentMap[K, V]) hooks() *hookSet[K, V] {
+	hs, _ := m.state.hooks.Load().(*hookSet[K, V])
+	return hs
+}
+
+// updateHooks replaces the registered hooks by fn applied to a copy of them.
+//
+// updateHooks 将已注册的回调替换为 fn 作用于其副本的结果
+func (m ConcurrentMap[K, V]) updateHooks(fn func(all []*Hooks[K, V]) []*Hooks[K, V]) {
+	s := m.state
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	var all []*Hooks[K, V]
+	if cur := m.hooks(); cur != nil {
+		all = append(all, cur.all...)
+	}
+	all = fn(all)
+	if len(all) == 0 {
+		s.hooks.Store((*hookSet[K, V])(nil))
+		return
+	}
+	next := &hookSet[K, V]{all: all}
+	for _, h := range all {
+		next.onSet = next.onSet || h.OnSet != nil
+	}
+	s.hooks.Store(next)
+}
+
+// set runs the OnSet hooks.
+//
+// set 执行 OnSet 回调
+func (hs *hookSet[K, V]) set(key K, old V, replaced bool, value V) {
+	for _, h := range hs.all {
+		if h.OnSet != nil {
+			h.OnSet(key, old, replaced, value)
+		}
+	}
+}
+
+// remove runs the OnRemove hooks, or the OnEvict hooks for an expired or
+// evicted key.
+//
+// remove 执行 OnRemove 回调, 对过期或被淘汰的key执行 OnEvict 回调
+func (hs *hookSet[K, V]) remove(key K, old V, typ EventType) {
+	for _, h := range hs.all {
+		if typ != EventRemove && h.OnEvict != nil {
+			h.OnEvict(key, old, typ)
+		} else if h.OnRemove != nil {
+			h.OnRemove(key, old)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package cmap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAddHooks(t *testing.T) {
+	m := New[int]()
+	var calls []string
+	remove := m.AddHooks(Hooks[string, int]{
+		OnSet: func(key string, old int, replaced bool, value int) {
+			calls = append(calls, fmt.Sprint("set ", key, " ", old, " ", replaced, " ", value))
+		},
+		OnRemove: func(key string, old int) {
+			calls = append(calls, fmt.Sprint("remove ", key, " ", old))
+		},
+	})
+	copied := m
+	copied.AddHooks(Hooks[string, int]{
+		OnSet: func(key string, old int, replaced bool, value int) {
+			calls = append(calls, "second")
+		},
+	})
+
+	m.Set("a", 1)
+	m.Upsert("a", 2, func(exist bool, old, new int) int { return old + new })
+	m.Pop("a")
+	m.Clear()
+	remove()
+	remove()
+	m.Set("b", 1)
+
+	expected := []string{"set a 0 false 1", "second", "set a 1 true 3", "second", "remove a 3", "second"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Error("got hook calls", calls, "expected", expected)
+	}
+	if m.AddHooks(Hooks[string, int]{}) == nil {
+		t.Error("AddHooks should return a remove function")
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	var removed []string
+	var evicted []EventType
+	m, err := NewWithOptions[string, int](WithShardCount(1), WithMaxEntries(2), WithHooks(Hooks[string, int]{
+		OnRemove: func(key string, old int) {
+			removed = append(removed, key)
+		},
+		OnEvict: func(key string, old int, reason EventType) {
+			evicted = append(evicted, reason)
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Set("c", 3)
+	m.SetWithTTL("d", 4, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	m.Get("d")
+	m.Remove("c")
+
+	if fmt.Sprint(evicted) != fmt.Sprint([]EventType{EventEvict, EventEvict, EventExpire}) {
+		t.Error("unexpected OnEvict reasons", evicted)
+	}
+	if fmt.Sprint(removed) != "[c]" {
+		t.Error("OnRemove should only be called for removals when OnEvict is set, got", removed)
+	}
+}
+
+func TestHooksOnDecode(t *testing.T) {
+	sets := 0
+	m, _ := NewWithOptions[string, int](WithHooks(Hooks[string, int]{
+		OnSet: func(key string, old int, replaced bool, value int) { sets++ },
+	}))
+	if err := m.UnmarshalJSON([]byte(`{"a":1,"b":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if sets != 2 {
+		t.Error("decoded entries should run OnSet, got", sets)
+	}
+}
+
+func TestHooksNotRunOnReplay(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestWAL(t, dir)
+	m.Set("a", 1)
+	m.Close()
+
+	sets := 0
+	n := openTestWAL(t, dir, WithHooks(Hooks[string, int]{
+		OnSet: func(key string, old int, replaced bool, value int) { sets++ },
+	}))
+	defer n.Close()
+	if !n.Has("a") || sets != 0 {
+		t.Error("replaying the write-ahead log should not run the hooks, got", sets, "calls")
+	}
+}
+
+func TestHooksOverwriteExpired(t *testing.T) {
+	events := func(withHook bool) []EventType {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		m := New[int]()
+		replaced := false
+		if withHook {
+			m.AddHooks(Hooks[string, int]{
+				OnSet: func(key string, old int, r bool, value int) { replaced = replaced || r },
+			})
+		}
+		ch := m.Watch(ctx)
+		m.SetWithTTL("a", 1, time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+		m.Set("a", 2)
+		if replaced {
+			t.Error("an expired key should not be reported as replaced")
+		}
+		var got []EventType
+		for len(ch) > 0 {
+			got = append(got, (<-ch).Type)
+		}
+		return got
+	}
+	without, with := events(false), events(true)
+	if fmt.Sprint(without) != fmt.Sprint(with) || len(with) != 2 {
+		t.Error("hooks should not change the events, got", without, "and", with)
+	}
+}
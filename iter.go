@@ -0,0 +1,36 @@
+package cmap
+
+import (
+	"time"
+)
+
+// each calls yield for every key, value pair without spawning goroutines,
+// stopping as soon as yield returns false.
+// Each shard is copied under its read lock and yielded after it is unlocked,
+// so yield may access the map; it sees a consistent view of a shard,
+// but not across the shards.
+//
+// each 对每个键值对调用 yield, 不启动任何goroutine, yield 返回 false 时立即停止.
+// 每个分片在持有读锁时被复制, 解锁之后才调用 yield, 因此 yield 可以访问该map;
+// yield 会获得分片的一致视图, 但不会跨越分片.
+func (m ConcurrentMap[K, V]) each(yield func(key K, v V) bool) {
+	t := m.table()
+	var items []Tuple[K, V]
+	for i := range t.shards {
+		items = items[:0]
+		walk(t, i, false, func(shard *ConcurrentMapShared[K, V]) bool {
+			now := time.Now().UnixNano()
+			for key, val := range shard.items {
+				if !shard.expired(key, now) {
+					items = append(items, Tuple[K, V]{key, val})
+				}
+			}
+			return true
+		})
+		for _, item := range items {
+			if !yield(item.Key, item.Val) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !go1.23
+
+package cmap
+
+// All returns an iterator over key, value pairs. It has the same type as
+// iter.Seq2[K, V], which is available since Go 1.23. It spawns no goroutines.
+// Each shard is copied under its read lock before it is yielded,
+// so yield may access the map.
+//
+// All 返回键值对迭代器, 其类型与 Go 1.23 起提供的 iter.Seq2[K, V] 相同, 不启动任何goroutine.
+// 每个分片在持有读锁时被复制之后才被迭代, 因此 yield 可以访问该map.
+func (m ConcurrentMap[K, V]) All() func(yield func(K, V) bool) {
+	return m.each
+}
+
+// KeysSeq returns an iterator over keys, see All.
+//
+// KeysSeq 返回key的迭代器, 参见 All.
+func (m ConcurrentMap[K, V]) KeysSeq() func(yield func(K) bool) {
+	return func(yield func(K) bool) {
+		m.each(func(key K, _ V) bool {
+			return yield(key)
+		})
+	}
+}
+
+// Values returns an iterator over values, see All.
+//
+// Values 返回值的迭代器, 参见 All.
+func (m ConcurrentMap[K, V]) Values() func(yield func(V) bool) {
+	return func(yield func(V) bool) {
+		m.each(func(_ K, v V) bool {
+			return yield(v)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+//go:build go1.23
+
+package cmap
+
+import (
+	"iter"
+)
+
+// All returns an iterator over key, value pairs which could be used in a
+// for range loop and supports break. It spawns no goroutines.
+// Each shard is copied under its read lock before it is yielded,
+// so the loop body may access the map.
+//
+// All 返回键值对迭代器, 可以在支持 break 的 for range 循环中使用, 不启动任何goroutine.
+// 每个分片在持有读锁时被复制之后才被迭代, 因此循环体可以访问该map.
+func (m ConcurrentMap[K, V]) All() iter.Seq2[K, V] {
+	return m.each
+}
+
+// KeysSeq returns an iterator over keys, see All.
+//
+// KeysSeq 返回key的迭代器, 参见 All.
+func (m ConcurrentMap[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.each(func(key K, _ V) bool {
+			return yield(key)
+		})
+	}
+}
+
+// Values returns an iterator over values, see All.
+//
+// Values 返回值的迭代器, 参见 All.
+func (m ConcurrentMap[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.each(func(_ K, v V) bool {
+			return yield(v)
+		})
+	}
+}
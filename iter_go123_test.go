@@ -0,0 +1,68 @@
+//go:build go1.23
+
+package cmap
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	m := New[Animal]()
+
+	// Insert 100 elements.
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), Animal{strconv.Itoa(i)})
+	}
+
+	counter := 0
+	for key, val := range m.All() {
+		if val.name != key {
+			t.Error("item was modified.")
+		}
+		counter++
+	}
+	if counter != 100 {
+		t.Error("We should have counted 100 elements.")
+	}
+
+	keys := 0
+	for range m.KeysSeq() {
+		keys++
+	}
+	values := 0
+	for range m.Values() {
+		values++
+	}
+	if keys != 100 || values != 100 {
+		t.Error("We should have counted 100 elements.")
+	}
+}
+
+func TestAllBreak(t *testing.T) {
+	m := New[int]()
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+
+	goroutines := runtime.NumGoroutine()
+	counter := 0
+	for key := range m.All() {
+		// The loop body may write to the map.
+		m.Remove(key)
+		counter++
+		if counter == 42 {
+			break
+		}
+	}
+	if counter != 42 {
+		t.Error("We should have been right where we stopped")
+	}
+	if runtime.NumGoroutine() != goroutines {
+		t.Error("All should not spawn goroutines")
+	}
+	if m.Count() != 58 {
+		t.Error("Expecting 58 elements.")
+	}
+}
@@ -0,0 +1,235 @@
+package cmap
+
+import (
+	"bufio"
+	"encoding"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// EncodeJSON writes the map to w as a JSON object, shard by shard.
+// Only one shard is copied at a time, so memory stays bounded by the
+// largest shard instead of the whole map. Like Items, the output is
+// consistent per shard, but not across the shards.
+// With WithCanonical or WithKeyOrder, a Snapshot of the whole map is
+// written sorted by key instead.
+//
+// EncodeJSON 将map逐个分片地以JSON对象写入 w.
+// 同一时间只复制一个分片, 因此内存占用受限于最大的分片而不是整个map.
+// 与 Items 相同, 输出只保证单个分片的一致性.
+// 使用 WithCanonical 或 WithKeyOrder 时, 改为按key排序写入整个map的快照(Snapshot).
+func (m ConcurrentMap[K, V]) EncodeJSON(w io.Writer) error {
+	codec := m.codec()
+	if ok, less := m.canonical(); ok {
+		items := m.snapshotItems()
+		if err := sortItems(items, less, jsonKey[K]); err != nil {
+			return err
+		}
+		return writeJSONObject(w, codec, items)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+	first := true
+	t := m.table()
+	var items []Tuple[K, V]
+	for i := range t.shards {
+		items = items[:0]
+		walk(t, i, false, func(shard *ConcurrentMapShared[K, V]) bool {
+			now := time.Now().UnixNano()
+			for key, val := range shard.items {
+				if !shard.expired(key, now) {
+					items = append(items, Tuple[K, V]{key, val})
+				}
+			}
+			return true
+		})
+		for _, item := range items {
+			if err := writeJSONEntry(bw, codec, item.Key, item.Val, first); err != nil {
+				return err
+			}
+			first = false
+		}
+	}
+	bw.WriteByte('}')
+	return bw.Flush()
+}
+
+// writeJSONObject writes items to w as a JSON object, in order.
+//
+// writeJSONObject 将 items 按顺序以JSON对象写入 w
+func writeJSONObject[K comparable, V any](w io.Writer, codec Codec, items []Tuple[K, V]) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+	for i, item := range items {
+		if err := writeJSONEntry(bw, codec, item.Key, item.Val, i == 0); err != nil {
+			return err
+		}
+	}
+	bw.WriteByte('}')
+	return bw.Flush()
+}
+
+// writeJSONEntry writes `"key":value` to w using codec, preceded by a comma unless first.
+//
+// writeJSONEntry 使用 codec 将 `"key":value` 写入 w, 除第一个元素外前面加逗号
+func writeJSONEntry[K comparable, V any](w *bufio.Writer, codec Codec, key K, val V, first bool) error {
+	name, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	k, err := codec.Marshal(name)
+	if err != nil {
+		return err
+	}
+	v, err := codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	if !first {
+		w.WriteByte(',')
+	}
+	w.Write(k)
+	w.WriteByte(':')
+	_, err = w.Write(v)
+	return err
+}
+
+// DecodeJSON reads a JSON object from r into the map, token by token,
+// combining entries as set by WithMergePolicy. Entries are set as they are
+// decoded, so memory stays bounded by the largest value instead of the
+// whole input; on error the entries decoded so far are kept. MergeReplace
+// clears the map only once the opening '{' is read, and null leaves the map
+// unchanged. Under MergeFailOnConflict the entries are buffered and set all
+// at once, or not at all.
+// A zero value map is initialized first.
+//
+// DecodeJSON 从 r 逐个token地读取JSON对象到map中, 按照 WithMergePolicy 的设置合并元素.
+// 元素在解码后立即被设置, 因此内存占用受限于最大的值而不是整个输入; 出错时已解码的元素会被保留.
+// MergeReplace 在读到开头的 '{' 之后才清空map, null 不改变map.
+// MergeFailOnConflict 时元素先被缓存, 然后全部设置或全部不设置.
+// 零值map会先被初始化.
+func (m *ConcurrentMap[K, V]) DecodeJSON(r io.Reader) error {
+	m.lazyInit()
+	codec := m.codec()
+	dec := stdjson.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(stdjson.Delim); !ok || delim != '{' {
+		return fmt.Errorf("cmap: expected JSON object, got %v", tok)
+	}
+
+	buffered := m.state.merge == MergeFailOnConflict
+	var items []Tuple[K, V]
+	if !buffered {
+		m.beginDecode()
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, err := decodeKey[K](tok.(string))
+		if err != nil {
+			return err
+		}
+		var raw stdjson.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		var val V
+		if err := codec.Unmarshal(raw, &val); err != nil {
+			return err
+		}
+		if buffered {
+			items = append(items, Tuple[K, V]{key, val})
+		} else {
+			m.Set(key, val)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if buffered {
+		return m.mergeAll(items, nil)
+	}
+	return nil
+}
+
+// encodeKey returns the JSON object key of key, following encoding/json:
+// string kinds are used directly, encoding.TextMarshaler keys are marshaled,
+// and integer kinds are formatted as decimal strings.
+//
+// encodeKey 返回key对应的JSON对象键, 规则与 encoding/json 相同:
+// 字符串类型直接使用, 实现 encoding.TextMarshaler 的键调用 MarshalText, 整数类型格式化为十进制字符串.
+func encodeKey[K comparable](key K) (string, error) {
+	v := reflect.ValueOf(&key).Elem()
+	if v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	if tm, ok := any(key).(encoding.TextMarshaler); ok {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return "", nil
+		}
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("cmap: unsupported JSON key type %T", key)
+}
+
+// jsonKey returns the encoded JSON object key of key.
+//
+// jsonKey 返回key编码后的JSON对象键
+func jsonKey[K comparable](key K) ([]byte, error) {
+	name, err := encodeKey(key)
+	return []byte(name), err
+}
+
+// decodeKey parses a JSON object key, following encoding/json:
+// keys whose pointer implements encoding.TextUnmarshaler are unmarshaled,
+// string kinds are set directly, and integer kinds are parsed as decimal.
+//
+// decodeKey 解析JSON对象键, 规则与 encoding/json 相同:
+// 指针实现 encoding.TextUnmarshaler 的键调用 UnmarshalText, 字符串类型直接设置, 整数类型按十进制解析.
+func decodeKey[K comparable](name string) (key K, err error) {
+	if tu, ok := any(&key).(encoding.TextUnmarshaler); ok {
+		err = tu.UnmarshalText([]byte(name))
+		return key, err
+	}
+	v := reflect.ValueOf(&key).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(name)
+		return key, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || v.OverflowInt(n) {
+			return key, fmt.Errorf("cmap: invalid JSON key %q for type %T", name, key)
+		}
+		v.SetInt(n)
+		return key, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || v.OverflowUint(n) {
+			return key, fmt.Errorf("cmap: invalid JSON key %q for type %T", name, key)
+		}
+		v.SetUint(n)
+		return key, nil
+	}
+	return key, fmt.Errorf("cmap: unsupported JSON key type %T", key)
+}
@@ -0,0 +1,242 @@
+package cmap
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	m := New[Animal]()
+	m.Set("a", Animal{"x"})
+	m.Set("b\"", Animal{"y"})
+	buf := bytes.Buffer{}
+	if err := m.EncodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := stdjson.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := New[Animal]()
+	if err := n.UnmarshalJSON(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	again, err := stdjson.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(expected) {
+		t.Error("json", string(again), "differ from expected", string(expected))
+	}
+
+	empty := New[int]()
+	buf.Reset()
+	if err := empty.EncodeJSON(&buf); err != nil || buf.String() != "{}" {
+		t.Error("empty map should encode as {}, got", buf.String())
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	m := New[int]()
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	buf := bytes.Buffer{}
+	if err := m.EncodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	n := New[int]()
+	if err := n.DecodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if n.Count() != 1000 {
+		t.Error("Expecting 1000 elements.")
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := n.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Error("missing value", i)
+		}
+	}
+
+	if err := n.DecodeJSON(strings.NewReader("null")); err != nil {
+		t.Error(err)
+	}
+	if err := n.DecodeJSON(strings.NewReader("[1]")); err == nil {
+		t.Error("non-object input should be rejected")
+	}
+	if err := n.DecodeJSON(strings.NewReader(`{"a":"b"}`)); err == nil {
+		t.Error("mismatched value type should be rejected")
+	}
+	if err := n.DecodeJSON(strings.NewReader(`{"a":1`)); err == nil {
+		t.Error("truncated input should be rejected")
+	}
+}
+
+// version is a struct key encoded through encoding.TextMarshaler.
+type version struct {
+	Major, Minor int
+}
+
+func (v version) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%d", v.Major, v.Minor)), nil
+}
+
+func (v *version) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+type label string
+
+// roundTripJSON checks that m encodes like encoding/json does on its items,
+// and decodes back to the same items through both decoders.
+func roundTripJSON[K comparable, V comparable](t *testing.T, m ConcurrentMap[K, V]) {
+	t.Helper()
+	data, err := m.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := stdjson.Marshal(m.Items())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(expected) {
+		t.Errorf("MarshalJSON = %s, encoding/json = %s", data, expected)
+	}
+
+	var n ConcurrentMap[K, V]
+	if err := n.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	var s ConcurrentMap[K, V]
+	buf := bytes.Buffer{}
+	if err := m.EncodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DecodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range []ConcurrentMap[K, V]{n, s} {
+		if got.Count() != m.Count() {
+			t.Errorf("decoded %d elements, expected %d", got.Count(), m.Count())
+		}
+		m.IterCb(func(key K, val V) {
+			if v, ok := got.Get(key); !ok || v != val {
+				t.Errorf("key %v: got %v, expected %v", key, v, val)
+			}
+		})
+	}
+}
+
+func TestJSONKeyKinds(t *testing.T) {
+	strs := New[int]()
+	strs.Set("a", 1)
+	strs.Set("b\"", 2)
+	roundTripJSON(t, strs)
+
+	labels := NewComparable[label, int]()
+	labels.Set("x", 1)
+	labels.Set("y", 2)
+	roundTripJSON(t, labels)
+
+	ints := NewInt[int, string]()
+	ints.Set(-1, "a")
+	ints.Set(0, "b")
+	ints.Set(math.MaxInt64, "c")
+	roundTripJSON(t, ints)
+
+	small := NewInt[int8, string]()
+	small.Set(math.MinInt8, "a")
+	roundTripJSON(t, small)
+
+	uints := NewInt[uint64, string]()
+	uints.Set(math.MaxUint64, "a")
+	uints.Set(7, "b")
+	roundTripJSON(t, uints)
+
+	versions := NewComparable[version, string]()
+	versions.Set(version{1, 2}, "a")
+	versions.Set(version{10, 0}, "b")
+	roundTripJSON(t, versions)
+
+	addrs := NewComparable[netip.Addr, bool]()
+	addrs.Set(netip.MustParseAddr("10.0.0.1"), true)
+	addrs.Set(netip.MustParseAddr("::1"), false)
+	roundTripJSON(t, addrs)
+}
+
+func TestJSONKeyErrors(t *testing.T) {
+	coords := NewComparable[coord, int]()
+	coords.Set(coord{1, 2}, 3)
+	if _, err := coords.MarshalJSON(); err == nil {
+		t.Error("struct keys without MarshalText should be rejected")
+	}
+	if err := coords.EncodeJSON(io.Discard); err == nil {
+		t.Error("struct keys without MarshalText should be rejected")
+	}
+
+	small := NewInt[int8, int]()
+	if err := small.UnmarshalJSON([]byte(`{"128":1}`)); err == nil {
+		t.Error("overflowing keys should be rejected")
+	}
+	uints := NewInt[uint, int]()
+	if err := uints.DecodeJSON(strings.NewReader(`{"-1":1}`)); err == nil {
+		t.Error("negative unsigned keys should be rejected")
+	}
+	versions := NewComparable[version, int]()
+	if err := versions.UnmarshalJSON([]byte(`{"x":1}`)); err == nil {
+		t.Error("UnmarshalText errors should be returned")
+	}
+	if err := versions.UnmarshalJSON([]byte(`{"1.2":"a"}`)); err == nil {
+		t.Error("mismatched value type should be rejected")
+	}
+	if versions.Count() != 0 {
+		t.Error("failed UnmarshalJSON should not modify the map")
+	}
+}
+
+// upperCodec is a Codec that upper-cases every string it marshals.
+type upperCodec struct {
+	StdCodec
+}
+
+func (c upperCodec) Marshal(v any) ([]byte, error) {
+	if s, ok := v.(string); ok {
+		v = strings.ToUpper(s)
+	}
+	return c.StdCodec.Marshal(v)
+}
+
+func TestWithCodec(t *testing.T) {
+	m, err := NewWithOptions[string, string](WithCodec(upperCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set("a", "b")
+	data, err := m.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"A":"B"}` {
+		t.Error("MarshalJSON should use the map codec, got", string(data))
+	}
+	buf := bytes.Buffer{}
+	if err := m.EncodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"A":"B"}` {
+		t.Error("EncodeJSON should use the map codec, got", buf.String())
+	}
+
+	var n ConcurrentMap[string, string]
+	if n.codec() != (StdCodec{}) {
+		t.Error("zero value map should use StdCodec")
+	}
+}
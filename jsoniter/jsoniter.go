@@ -0,0 +1,22 @@
+// Package jsoniter provides a cmap.Codec backed by jsoniter, so that only
+// programs importing it depend on jsoniter.
+//
+// jsoniter 包提供基于 jsoniter 的 cmap.Codec, 只有导入它的程序才依赖 jsoniter.
+package jsoniter
+
+import (
+	"github.com/Coloured-glaze/cmap"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Codec is jsoniter configured to be compatible with encoding/json.
+//
+// Codec 是与 encoding/json 兼容配置的 jsoniter
+var Codec cmap.Codec = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// WithCodec sets Codec as the JSON codec of the map.
+//
+// WithCodec 将 Codec 设置为map的JSON编解码器
+func WithCodec() cmap.Option {
+	return cmap.WithCodec(Codec)
+}
@@ -0,0 +1,55 @@
+package jsoniter
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Coloured-glaze/cmap"
+)
+
+func TestCodec(t *testing.T) {
+	m, err := cmap.NewWithOptions[string, []int](WithCodec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set("b", []int{1, 2})
+	m.Set("a", nil)
+	data, err := m.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":null,"b":[1,2]}` {
+		t.Error("unexpected json", string(data))
+	}
+
+	n, _ := cmap.NewWithOptions[string, []int](WithCodec())
+	if err := n.DecodeJSON(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := n.Get("b"); !ok || len(v) != 2 || v[1] != 2 {
+		t.Error("decoded value mismatch", v)
+	}
+
+	u, _ := cmap.NewWithOptions[string, []int](WithCodec())
+	if err := u.UnmarshalJSON([]byte(`{"1":[1,2],"2":null}`)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := u.Get("2"); !ok || v != nil {
+		t.Error("null should decode to a nil slice, got", v, ok)
+	}
+	if v, ok := u.Get("1"); !ok || len(v) != 2 {
+		t.Error("decoded value mismatch", v)
+	}
+}
+
+func TestCmapDoesNotImportJsoniter(t *testing.T) {
+	out, err := exec.Command("go", "list", "-deps", "github.com/Coloured-glaze/cmap").Output()
+	if err != nil {
+		t.Skip("go list unavailable:", err)
+	}
+	if strings.Contains(string(out), "json-iterator") {
+		t.Error("cmap should not depend on jsoniter")
+	}
+}
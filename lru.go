@@ -0,0 +1,143 @@
+package cmap
+
+import (
+	"container/list"
+)
+
+// lruReadBuffer is the number of reads a shard records before they are applied.
+//
+// lruReadBuffer 是分片在应用之前记录的读取次数
+const lruReadBuffer = 64
+
+// WithMaxEntries bounds the map to about n entries. Every shard holds at most
+// n divided by the shard count (rounded up), the least recently used entry of
+// a full shard is evicted when a new key is inserted into it.
+//
+// WithMaxEntries 将map的元素数量限制为约 n 个. 每个分片最多持有 n 除以分片数量(向上取整)个元素,
+// 向已满的分片插入新key时淘汰其中最近最少使用的元素.
+func WithMaxEntries(n int) Option {
+	return func(o *options) {
+		o.maxEntries = n
+	}
+}
+
+// lru tracks the recency of the keys of a shard.
+// Writers update it under the shard lock. Readers only hold the read lock,
+// so they record the key in reads, which is applied by the next writer;
+// reads are dropped when the buffer is full.
+//
+// lru 记录分片中key的使用顺序.
+// 写操作在持有分片锁时更新它. 读操作只持有读锁, 因此只将key记录到 reads 中, 由下一个写操作应用,
+// 缓冲区满时读取记录被丢弃.
+type lru[K comparable] struct {
+	order *list.List          // 最近使用的在前
+	elems map[K]*list.Element // key 在 order 中的位置
+	reads chan K              // 尚未应用的读取记录
+}
+
+func newLRU[K comparable]() *lru[K] {
+	return &lru[K]{
+		order: list.New(),
+		elems: make(map[K]*list.Element),
+		reads: make(chan K, lruReadBuffer),
+	}
+}
+
+// read records a read of key, the shard must be locked for reading.
+// It reports false if the read buffer is full.
+//
+// read 记录对key的读取, 分片必须已加读锁. 读取缓冲区已满时返回 false.
+func (l *lru[K]) read(key K) bool {
+	select {
+	case l.reads <- key:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain applies the recorded reads, the shard must be locked.
+//
+// drain 应用已记录的读取, 分片必须已加锁
+func (l *lru[K]) drain() {
+	for {
+		select {
+		case key := <-l.reads:
+			if e, ok := l.elems[key]; ok {
+				l.order.MoveToFront(e)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// touch marks key as the most recently used, the shard must be locked.
+//
+// touch 将key标记为最近使用, 分片必须已加锁
+func (l *lru[K]) touch(key K) {
+	if e, ok := l.elems[key]; ok {
+		l.order.MoveToFront(e)
+		return
+	}
+	l.elems[key] = l.order.PushFront(key)
+}
+
+// forget removes key, the shard must be locked.
+//
+// forget 删除key, 分片必须已加锁
+func (l *lru[K]) forget(key K) {
+	if e, ok := l.elems[key]; ok {
+		l.order.Remove(e)
+		delete(l.elems, key)
+	}
+}
+
+// oldest returns the least recently used key, the shard must be locked.
+//
+// oldest 返回最近最少使用的key, 分片必须已加锁
+func (l *lru[K]) oldest() (key K, ok bool) {
+	e := l.order.Back()
+	if e == nil {
+		return key, false
+	}
+	return e.Value.(K), true
+}
+
+// used records a write of key to the locked shard and evicts the least
+// recently used entries while the shard is over its limit.
+//
+// used 记录对已加锁分片中key的写入, 并在分片超过上限时淘汰最近最少使用的元素
+func (m ConcurrentMap[K, V]) used(shard *ConcurrentMapShared[K, V], key K) {
+	shard.lru.drain()
+	shard.lru.touch(key)
+	n := len(m.table().shards)
+	limit := (m.state.maxEntries + n - 1) / n
+	for len(shard.items) > limit {
+		oldest, ok := shard.lru.oldest()
+		if !ok || oldest == key {
+			return
+		}
+		m.removeAs(shard, oldest, EventEvict)
+	}
+}
+
+// recordRead records a read of key from the shard, which is locked for reading.
+// The shard is unlocked on return.
+//
+// recordRead 记录对已加读锁分片中key的读取, 返回时分片已解锁.
+func (cms *ConcurrentMapShared[K, V]) recordRead(key K) {
+	if cms.lru.read(key) {
+		cms.RUnlock()
+		return
+	}
+	cms.RUnlock()
+	// The buffer is full, apply it unless a writer is doing so.
+	// 缓冲区已满, 除非有写操作正在应用它, 否则由此应用.
+	if cms.TryLock() {
+		if cms.lru != nil {
+			cms.lru.drain()
+		}
+		cms.Unlock()
+	}
+}
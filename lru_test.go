@@ -0,0 +1,96 @@
+package cmap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMaxEntries(t *testing.T) {
+	m, err := NewWithOptions[string, int](WithShardCount(4), WithMaxEntries(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	if n := m.Count(); n > 100 {
+		t.Error("map should contain at most 100 elements, got", n)
+	}
+	if !m.Has("999") {
+		t.Error("the last inserted element should not be evicted")
+	}
+
+	if _, err := NewWithOptions[string, int](WithMaxEntries(-1)); err != ErrInvalidMaxEntries {
+		t.Error("negative max entries should be rejected, got", err)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	evicted := []string{}
+	m, err := NewWithOptions[string, int](WithShardCount(1), WithMaxEntries(3), WithHooks(Hooks[string, int]{
+		OnRemove: func(key string, old int) {
+			evicted = append(evicted, key)
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Set("c", 3)
+
+	// Reading "a" makes "b" the least recently used.
+	m.Get("a")
+	m.Set("d", 4)
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Error("Expecting b to be evicted, got", evicted)
+	}
+
+	// Updating "c" makes "a" the least recently used.
+	m.Set("c", 5)
+	m.Set("e", 6)
+	if len(evicted) != 2 || evicted[1] != "a" {
+		t.Error("Expecting a to be evicted, got", evicted)
+	}
+
+	m.Remove("d")
+	m.Set("f", 7)
+	if len(evicted) != 3 || m.Count() != 3 {
+		t.Error("Removed element should not be evicted again, got", evicted)
+	}
+}
+
+func TestLRUConcurrent(t *testing.T) {
+	m, err := NewWithOptions[string, int](WithShardCount(2), WithMaxEntries(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := strconv.Itoa(i % 200)
+				m.Set(key, i)
+				m.Get(key)
+				if i == 1000 && w == 0 {
+					if err := m.Reshard(8); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if n := m.Count(); n > 64 {
+		t.Error("map should contain at most 64 elements, got", n)
+	}
+	m.walkAll(false, func(shard *ConcurrentMapShared[string, int]) bool {
+		if len(shard.lru.elems) != len(shard.items) || shard.lru.order.Len() != len(shard.items) {
+			t.Error("recency list out of sync with shard")
+		}
+		return true
+	})
+}
@@ -0,0 +1,131 @@
+package cmap
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrKeyConflict is returned when MergeFailOnConflict finds a decoded key
+// that is already in the map.
+//
+// MergeFailOnConflict 发现解码的key已存在于map中时返回 ErrKeyConflict
+var ErrKeyConflict = errors.New("cmap: key already exists")
+
+// MergePolicy decides how decoded entries combine with the current contents
+// of the map in UnmarshalJSON, DecodeJSON, UnmarshalBinary, GobDecode and
+// LoadSnapshot.
+//
+// MergePolicy 决定 UnmarshalJSON, DecodeJSON, UnmarshalBinary, GobDecode 和 LoadSnapshot 解码的元素如何与map当前内容合并.
+type MergePolicy int
+
+const (
+	// MergeOverwrite keeps the current entries, decoded entries overwrite
+	// existing keys. It is the default.
+	//
+	// MergeOverwrite 保留当前的元素, 解码的元素覆盖已存在的key. 这是默认值.
+	MergeOverwrite MergePolicy = iota
+	// MergeReplace removes the current entries before decoded entries are set.
+	// It is not atomic, readers may see the map partially decoded.
+	//
+	// MergeReplace 在设置解码的元素之前删除当前的元素. 它不是原子的, 读操作可能看到解码了一部分的map.
+	MergeReplace
+	// MergeFailOnConflict fails with ErrKeyConflict when a decoded key is
+	// already in the map, leaving the map unchanged. Every shard is locked
+	// while the entries are checked and set, so hooks and WatchBlock watchers
+	// of those entries hold up writers of the whole map.
+	//
+	// MergeFailOnConflict 在解码的key已存在于map中时返回 ErrKeyConflict, map保持不变.
+	// 检查和设置元素时所有分片都被加锁, 因此这些元素的回调和 WatchBlock 订阅者会阻塞整个map的写入.
+	MergeFailOnConflict
+)
+
+// WithMergePolicy sets how decoded entries combine with existing ones.
+//
+// WithMergePolicy 设置解码的元素如何与已有元素合并
+func WithMergePolicy(policy MergePolicy) Option {
+	return func(o *options) {
+		o.merge = policy
+	}
+}
+
+// lazyInit initializes a zero value map with the defaults of NewWithOptions.
+// It is not safe for concurrent use, the zero value is not shared yet.
+//
+// lazyInit 以 NewWithOptions 的默认配置初始化零值map. 它不是并发安全的, 零值此时尚未被共享.
+func (m *ConcurrentMap[K, V]) lazyInit() {
+	if m.state == nil {
+		*m = create[K, V](SHARD_COUNT, defaultSharding[K](HashSeeded), &mapState[K, V]{})
+	}
+}
+
+// beginDecode prepares the map for decoded entries.
+//
+// beginDecode 为解码的元素准备map
+func (m *ConcurrentMap[K, V]) beginDecode() {
+	m.lazyInit()
+	if m.state.merge == MergeReplace {
+		m.Clear()
+	}
+}
+
+// mergeAll combines decoded items with the map according to the merge policy.
+// deadlines, if not nil, holds the expiry deadline of each item, 0 for the
+// default TTL; expired items are skipped.
+// Under MergeFailOnConflict every key is checked while all shards are
+// locked, and nothing is set if any of them is already in the map.
+//
+// mergeAll 按照合并策略将解码的元素与map合并.
+// deadlines 不为 nil 时为每个元素的过期时刻, 0 表示使用默认过期时间; 已过期的元素被跳过.
+// MergeFailOnConflict 时在所有分片都加锁的情况下检查每个key, 只要有一个已存在于map中就不设置任何元素.
+func (m *ConcurrentMap[K, V]) mergeAll(items []Tuple[K, V], deadlines []int64) error {
+	m.beginDecode()
+	now := time.Now().UnixNano()
+	// ttl returns the TTL of item i, false if it is expired.
+	// ttl 返回第 i 个元素的过期时间, 已过期时返回 false.
+	ttl := func(i int) (time.Duration, bool) {
+		if deadlines == nil || deadlines[i] == 0 {
+			return m.state.defaultTTL, true
+		}
+		return time.Duration(deadlines[i] - now), deadlines[i] > now
+	}
+	if m.state.merge != MergeFailOnConflict {
+		for i, item := range items {
+			if d, ok := ttl(i); ok {
+				m.SetWithTTL(item.Key, item.Val, d)
+			}
+		}
+		return nil
+	}
+	var err error
+	m.lockAll(true, func([]*ConcurrentMapShared[K, V]) {
+		for i, item := range items {
+			if _, ok := ttl(i); !ok {
+				continue
+			}
+			if _, ok := m.owner(item.Key).peek(item.Key); ok {
+				err = fmt.Errorf("%w: %v", ErrKeyConflict, item.Key)
+				return
+			}
+		}
+		for i, item := range items {
+			if d, ok := ttl(i); ok {
+				m.store(m.owner(item.Key), item.Key, item.Val, d)
+			}
+		}
+	})
+	return err
+}
+
+// peek returns the value of key in the locked shard, treating an expired
+// key as absent. Unlike lookup it never removes anything.
+//
+// peek 返回已加锁分片中key的值, 过期的key视为不存在. 与 lookup 不同, 它不会删除任何元素.
+func (cms *ConcurrentMapShared[K, V]) peek(key K) (v V, ok bool) {
+	v, ok = cms.items[key]
+	if ok && cms.expiredNow(key) {
+		var zero V
+		return zero, false
+	}
+	return v, ok
+}
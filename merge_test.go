@@ -0,0 +1,134 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalIntoZeroValue(t *testing.T) {
+	var m ConcurrentMap[string, int]
+	if err := json.Unmarshal([]byte(`{"a":1,"b":2}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m.Get("b"); !ok || v != 2 || m.Count() != 2 {
+		t.Error("zero value map was not initialized by UnmarshalJSON")
+	}
+
+	var d ConcurrentMap[string, int]
+	if err := d.DecodeJSON(strings.NewReader(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Has("a") {
+		t.Error("zero value map was not initialized by DecodeJSON")
+	}
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b ConcurrentMap[string, int]
+	if err := b.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if b.Count() != 2 {
+		t.Error("zero value map was not initialized by UnmarshalBinary")
+	}
+
+	var s struct{ M ConcurrentMap[coord, int] }
+	if err := json.Unmarshal([]byte(`{"M":null}`), &s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergePolicy(t *testing.T) {
+	input := `{"a":1,"b":2}`
+	newMap := func(policy MergePolicy) ConcurrentMap[string, int] {
+		m, err := NewWithOptions[string, int](WithMergePolicy(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Set("a", 0)
+		m.Set("c", 3)
+		return m
+	}
+
+	m := newMap(MergeOverwrite)
+	if err := m.UnmarshalJSON([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Get("a"); v != 1 || m.Count() != 3 {
+		t.Error("MergeOverwrite should overwrite and keep existing keys", m.Items())
+	}
+
+	m = newMap(MergeReplace)
+	if err := m.UnmarshalJSON([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Get("a"); v != 1 || m.Has("c") || m.Count() != 2 {
+		t.Error("MergeReplace should replace the contents", m.Items())
+	}
+
+	m = newMap(MergeFailOnConflict)
+	if err := m.DecodeJSON(strings.NewReader(input)); !errors.Is(err, ErrKeyConflict) {
+		t.Error("MergeFailOnConflict should fail, got", err)
+	}
+	if v, _ := m.Get("a"); v != 0 {
+		t.Error("MergeFailOnConflict should not overwrite", m.Items())
+	}
+
+	src := New[int]()
+	src.Set("d", 4)
+	data, err := src.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = newMap(MergeFailOnConflict)
+	if err := m.UnmarshalBinary(data); err != nil || m.Count() != 3 {
+		t.Error("MergeFailOnConflict should accept new keys, got", err)
+	}
+
+	m = newMap(MergeReplace)
+	buf := bytes.Buffer{}
+	if err := src.EncodeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DecodeJSON(&buf); err != nil || m.Count() != 1 {
+		t.Error("MergeReplace should replace the contents", m.Items())
+	}
+}
+
+func TestMergeFailOnConflictUnchanged(t *testing.T) {
+	input := []byte(`{"a":1,"b":2,"c":3,"d":4,"e":5,"f":6,"x":7}`)
+	for i := 0; i < 50; i++ {
+		m, _ := NewWithOptions[string, int](WithMergePolicy(MergeFailOnConflict))
+		m.Set("x", 0)
+		if err := m.UnmarshalJSON(input); !errors.Is(err, ErrKeyConflict) {
+			t.Fatal("MergeFailOnConflict should fail, got", err)
+		}
+		if m.Count() != 1 {
+			t.Fatal("a conflict should leave the map unchanged, got", m.Items())
+		}
+		if err := m.DecodeJSON(bytes.NewReader(input)); !errors.Is(err, ErrKeyConflict) || m.Count() != 1 {
+			t.Fatal("a conflict should leave the map unchanged, got", m.Items())
+		}
+	}
+}
+
+func TestReplaceInvalidInput(t *testing.T) {
+	m, _ := NewWithOptions[string, int](WithMergePolicy(MergeReplace))
+	m.Set("a", 1)
+	for _, input := range []string{"garbage", "[1]", "null"} {
+		if err := m.DecodeJSON(strings.NewReader(input)); err == nil && input != "null" {
+			t.Error("invalid input should be rejected:", input)
+		}
+		if err := m.UnmarshalJSON([]byte(input)); err == nil && input != "null" {
+			t.Error("invalid input should be rejected:", input)
+		}
+		if m.Count() != 1 {
+			t.Fatal("input", input, "should leave the map unchanged")
+		}
+	}
+}
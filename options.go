@@ -0,0 +1,247 @@
+package cmap
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"reflect"
+	"time"
+)
+
+var (
+	// ErrInvalidShardCount is returned when the shard count is not positive.
+	//
+	// 分片数量不是正数时返回 ErrInvalidShardCount
+	ErrInvalidShardCount = errors.New("cmap: shard count must be positive")
+	// ErrInvalidCapacity is returned when the capacity hint is negative.
+	//
+	// 容量提示为负数时返回 ErrInvalidCapacity
+	ErrInvalidCapacity = errors.New("cmap: capacity must not be negative")
+	// ErrNilSharding is returned when a nil sharding function is given.
+	//
+	// 传入的分片函数为 nil 时返回 ErrNilSharding
+	ErrNilSharding = errors.New("cmap: sharding function is nil")
+	// ErrInvalidMaxEntries is returned when the maximum entry count is negative.
+	//
+	// 元素数量上限为负数时返回 ErrInvalidMaxEntries
+	ErrInvalidMaxEntries = errors.New("cmap: max entries must not be negative")
+)
+
+// Option configures a map created by NewWithOptions.
+//
+// Option 用于配置 NewWithOptions 创建的map
+type Option func(*options)
+
+type options struct {
+	shardCount  int
+	capacity    int
+	sharding    any // func(key K) uint32
+	hasSharding bool
+	hooks       any // Hooks[K, V]
+	hasHooks    bool
+	maxLoad     int
+	maxShards   int
+	defaultTTL  time.Duration
+	cleanup     time.Duration
+	maxEntries  int
+	hashMode    HashMode
+	merge       MergePolicy
+	codec       Codec
+	canonical   bool
+	keyLess     any // func(a, b K) bool
+	schema      uint32
+	walDir      string
+	syncPolicy  SyncPolicy
+	compactSize int64
+	watchBuffer int
+	watchPolicy WatchPolicy
+	stats       bool
+}
+
+// Hooks are synchronous callbacks invoked after every mutation, while the
+// lock of the shard holding the key is still held, so the hooks of a key run
+// in the order of its mutations. They MUST NOT access the same map and
+// should return quickly, writers of the shard wait meanwhile.
+// Resharding and replaying a write-ahead log do not run the hooks.
+//
+// Hooks 是每次修改之后同步调用的回调, 调用时仍持有该key所在分片的锁, 因此同一个key的回调按修改顺序执行.
+// 回调不能访问同一个map, 并且应尽快返回, 此期间该分片的写入会等待. 重新分片和重放预写日志不会执行回调.
+type Hooks[K comparable, V any] struct {
+	// OnSet is called after key is set to value by Set, MSet, SetIfAbsent,
+	// Upsert, SetWithTTL or a decoder; old is the previous value if replaced
+	// is true.
+	//
+	// OnSet 在key被 Set, MSet, SetIfAbsent, Upsert, SetWithTTL 或解码设置为value之后调用,
+	// replaced 为 true 时 old 为之前的值
+	OnSet func(key K, old V, replaced bool, value V)
+	// OnRemove is called after key holding old is removed by Remove, RemoveCb,
+	// Pop or Clear, and for expiry and eviction when OnEvict is nil.
+	//
+	// OnRemove 在值为 old 的key被 Remove, RemoveCb, Pop 或 Clear 删除之后调用,
+	// OnEvict 为 nil 时过期和淘汰也会调用它.
+	OnRemove func(key K, old V)
+	// OnEvict is called after key holding old is removed because it expired,
+	// reason EventExpire, or was evicted by WithMaxEntries, reason EventEvict.
+	//
+	// OnEvict 在值为 old 的key因过期(reason 为 EventExpire)或被 WithMaxEntries 淘汰(reason 为 EventEvict)而删除之后调用
+	OnEvict func(key K, old V, reason EventType)
+}
+
+// WithShardCount sets the number of shards, SHARD_COUNT by default.
+//
+// WithShardCount 设置分片数量, 默认为 SHARD_COUNT
+func WithShardCount(n int) Option {
+	return func(o *options) {
+		o.shardCount = n
+	}
+}
+
+// WithCapacity sets the initial capacity hint of each shard.
+//
+// WithCapacity 设置每个分片的初始容量
+func WithCapacity(n int) Option {
+	return func(o *options) {
+		o.capacity = n
+	}
+}
+
+// WithSharding sets the function used to choose the shard of a key.
+//
+// WithSharding 设置用于选择key所在分片的函数
+func WithSharding[K comparable](sharding func(key K) uint32) Option {
+	return func(o *options) {
+		o.sharding = sharding
+		o.hasSharding = true
+	}
+}
+
+// WithHooks registers mutation hooks of the map, see also AddHooks.
+//
+// WithHooks 注册map的修改回调, 另见 AddHooks
+func WithHooks[K comparable, V any](hooks Hooks[K, V]) Option {
+	return func(o *options) {
+		o.hooks = hooks
+		o.hasHooks = true
+	}
+}
+
+// Creates a new concurrent map configured by opts.
+// Without WithSharding, Hasher keys are sharded by their Hash method, other
+// keys are hashed with a random seed per map (see WithHashMode).
+//
+// 创建由 opts 配置的新并发map
+// 未使用 WithSharding 时, Hasher 类型的key通过其 Hash 方法分片, 其他key使用每个map不同的随机种子哈希(参见 WithHashMode)
+func NewWithOptions[K comparable, V any](opts ...Option) (ConcurrentMap[K, V], error) {
+	o := options{shardCount: SHARD_COUNT}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.shardCount <= 0 {
+		return ConcurrentMap[K, V]{}, ErrInvalidShardCount
+	}
+	if o.capacity < 0 {
+		return ConcurrentMap[K, V]{}, ErrInvalidCapacity
+	}
+	if o.maxEntries < 0 {
+		return ConcurrentMap[K, V]{}, ErrInvalidMaxEntries
+	}
+
+	var sharding func(key K) uint32
+	if o.hasSharding {
+		fn, ok := o.sharding.(func(key K) uint32)
+		if !ok {
+			return ConcurrentMap[K, V]{}, fmt.Errorf("cmap: sharding function %T does not match key type %T", o.sharding, *new(K))
+		}
+		if fn == nil {
+			return ConcurrentMap[K, V]{}, ErrNilSharding
+		}
+		sharding = fn
+	} else {
+		sharding = defaultSharding[K](o.hashMode)
+	}
+
+	state := &mapState[K, V]{
+		capacity:    o.capacity,
+		maxLoad:     o.maxLoad,
+		maxShards:   o.maxShards,
+		maxEntries:  o.maxEntries,
+		defaultTTL:  o.defaultTTL,
+		cleanup:     o.cleanup,
+		merge:       o.merge,
+		codec:       o.codec,
+		canonical:   o.canonical,
+		schema:      o.schema,
+		watchBuffer: o.watchBuffer,
+		watchPolicy: o.watchPolicy,
+		stats:       o.stats,
+	}
+	m := create[K, V](o.shardCount, sharding, state)
+	if o.keyLess != nil {
+		less, ok := o.keyLess.(func(a, b K) bool)
+		if !ok {
+			return ConcurrentMap[K, V]{}, fmt.Errorf("cmap: key order %T does not match key type %T", o.keyLess, *new(K))
+		}
+		m.state.keyLess = less
+	}
+	var hooks Hooks[K, V]
+	if o.hasHooks {
+		h, ok := o.hooks.(Hooks[K, V])
+		if !ok {
+			return ConcurrentMap[K, V]{}, fmt.Errorf("cmap: hooks %T do not match map type", o.hooks)
+		}
+		hooks = h
+	}
+	if o.walDir != "" {
+		if err := openWAL(m, o.walDir, o.syncPolicy, o.compactSize); err != nil {
+			return ConcurrentMap[K, V]{}, err
+		}
+	}
+	m.AddHooks(hooks)
+	return m, nil
+}
+
+// hashMethod returns the Hash method of K as a function, so that calling it
+// does not box the key like an interface assertion on every call would.
+//
+// hashMethod 以函数形式返回 K 的 Hash 方法, 调用时不会像每次进行接口断言那样装箱key.
+func hashMethod[K comparable]() (func(key K) uint64, bool) {
+	t := reflect.TypeOf((*K)(nil)).Elem()
+	if t.Kind() == reflect.Interface {
+		return nil, false
+	}
+	method, ok := t.MethodByName("Hash")
+	if !ok {
+		return nil, false
+	}
+	hash, ok := method.Func.Interface().(func(key K) uint64)
+	return hash, ok
+}
+
+// defaultSharding returns the sharding function used when none is given.
+func defaultSharding[K comparable](mode HashMode) func(key K) uint32 {
+	if hash, ok := hashMethod[K](); ok {
+		return func(key K) uint32 {
+			return fold(hash(key))
+		}
+	}
+	if mode == HashFnv32 {
+		if fn, ok := any(fnv32).(func(key K) uint32); ok {
+			return fn
+		}
+		if _, ok := any(*new(K)).(fmt.Stringer); ok {
+			return func(key K) uint32 {
+				return fnv32(any(key).(fmt.Stringer).String())
+			}
+		}
+	}
+	seed := maphash.MakeSeed()
+	if fn, ok := any(seededHash(seed)).(func(key K) uint32); ok {
+		return fn
+	}
+	if _, ok := any(*new(K)).(fmt.Stringer); ok {
+		return func(key K) uint32 {
+			return stringHash(seed, any(key).(fmt.Stringer).String())
+		}
+	}
+	return comparableHash[K](seed)
+}
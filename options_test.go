@@ -0,0 +1,96 @@
+package cmap
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	m, err := NewWithOptions[string, int](WithShardCount(8), WithCapacity(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ShardCount() != 8 {
+		t.Error("map should have exactly 8 shards.")
+	}
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	if m.Count() != 100 {
+		t.Error("Expecting 100 element within map.")
+	}
+
+	s, err := NewWithOptions[Integer, int]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(Integer(1), 1)
+	if v, ok := s.Get(Integer(1)); !ok || v != 1 {
+		t.Error("Stringer keys should be hashed by default.")
+	}
+
+	c, err := NewWithOptions[uint32, int](WithSharding(directSharding))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set(3, 3)
+	if c.GetShard(3) != c.table().shards[3] {
+		t.Error("custom sharding function was not used.")
+	}
+}
+
+func TestNewWithOptionsInvalid(t *testing.T) {
+	if _, err := NewWithOptions[string, int](WithShardCount(0)); err != ErrInvalidShardCount {
+		t.Error("zero shards should be rejected, got", err)
+	}
+	if _, err := NewWithOptions[string, int](WithCapacity(-1)); err != ErrInvalidCapacity {
+		t.Error("negative capacity should be rejected, got", err)
+	}
+	if _, err := NewWithOptions[string, int](WithSharding[string](nil)); err != ErrNilSharding {
+		t.Error("nil sharding function should be rejected, got", err)
+	}
+	if _, err := NewWithOptions[string, int](WithSharding(directSharding)); err == nil {
+		t.Error("sharding function of another key type should be rejected")
+	}
+	if _, err := NewWithOptions[string, int](WithHooks(Hooks[string, string]{})); err == nil {
+		t.Error("hooks of another map type should be rejected")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	sets, removes := 0, 0
+	m, err := NewWithOptions[string, int](WithHooks(Hooks[string, int]{
+		OnSet: func(key string, old int, replaced bool, value int) {
+			sets++
+			if replaced && old+1 != value {
+				t.Error("Wrong old value was provided to OnSet")
+			}
+		},
+		OnRemove: func(key string, old int) {
+			removes++
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set("a", 1)
+	m.Set("a", 2)
+	m.MSet(map[string]int{"b": 1})
+	m.SetIfAbsent("b", 5)
+	m.Upsert("c", 1, func(exist bool, valueInMap int, newValue int) int {
+		return newValue
+	})
+	if sets != 4 {
+		t.Error("Expecting 4 OnSet calls, got", sets)
+	}
+
+	m.Remove("a")
+	m.Remove("a")
+	m.Pop("b")
+	m.RemoveCb("c", func(key string, v int, exists bool) bool {
+		return true
+	})
+	if removes != 3 {
+		t.Error("Expecting 3 OnRemove calls, got", removes)
+	}
+}
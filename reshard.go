@@ -0,0 +1,305 @@
+package cmap
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrReshardNotMultiple is returned by Reshard when the new shard count is
+// not a multiple of the current one.
+//
+// 新的分片数量不是当前分片数量的倍数时, Reshard 返回 ErrReshardNotMultiple
+var ErrReshardNotMultiple = errors.New("cmap: new shard count must be a multiple of the current one")
+
+// shardTable is a generation of shards.
+// While resharding, every shard of the old table is migrated into next
+// one by one; a migrated shard is empty and keys are looked up in next.
+// Because the new shard count is a multiple of the old one, shard i of
+// next only holds keys from shard i%len(shards) of the old table.
+//
+// shardTable 是一代分片.
+// 重新分片时, 旧表的每个分片被逐个迁移到 next, 已迁移的分片为空, key需要在 next 中查找.
+// 由于新分片数量是旧分片数量的倍数, next 的第 i 个分片只包含旧表第 i%len(shards) 个分片中的key.
+type shardTable[K comparable, V any] struct {
+	shards  []*ConcurrentMapShared[K, V]
+	next    *shardTable[K, V] // 迁移目标, 在第一个分片被迁移之前设置
+	retired *shardStats       // 之前各代已迁移分片的计数之和, 仅在开启统计时非 nil
+}
+
+// newTable returns a shard table with shardCount empty shards.
+//
+// newTable 返回包含 shardCount 个空分片的分片表
+func (s *mapState[K, V]) newTable(shardCount int) *shardTable[K, V] {
+	t := &shardTable[K, V]{shards: make([]*ConcurrentMapShared[K, V], shardCount)}
+	for i := 0; i < shardCount; i++ {
+		t.shards[i] = &ConcurrentMapShared[K, V]{items: make(map[K]V, s.capacity)}
+		if s.maxEntries > 0 {
+			t.shards[i].lru = newLRU[K]()
+		}
+		if s.stats {
+			t.shards[i].stats = &shardStats{}
+		}
+	}
+	return t
+}
+
+// table returns the current shard table.
+//
+// table 返回当前的分片表
+func (m ConcurrentMap[K, V]) table() *shardTable[K, V] {
+	return m.state.table.Load().(*shardTable[K, V])
+}
+
+// lockShard returns the shard owning key, locked for writing.
+//
+// lockShard 返回持有key的分片, 并加写锁
+func (m ConcurrentMap[K, V]) lockShard(key K) *ConcurrentMapShared[K, V] {
+	hash := uint(m.sharding(key))
+	for t := m.table(); ; t = t.next {
+		shard := t.shards[hash%uint(len(t.shards))]
+		shard.lock()
+		if atomic.LoadInt32(&shard.migrated) == 0 {
+			return shard
+		}
+		shard.Unlock()
+	}
+}
+
+// rlockShard returns the shard owning key, locked for reading.
+//
+// rlockShard 返回持有key的分片, 并加读锁
+func (m ConcurrentMap[K, V]) rlockShard(key K) *ConcurrentMapShared[K, V] {
+	hash := uint(m.sharding(key))
+	for t := m.table(); ; t = t.next {
+		shard := t.shards[hash%uint(len(t.shards))]
+		shard.rlock()
+		if atomic.LoadInt32(&shard.migrated) == 0 {
+			return shard
+		}
+		shard.RUnlock()
+	}
+}
+
+// walk calls fn with every live shard holding keys of shard i of table t,
+// while the shard is locked (for writing if write is true).
+// It stops and returns false as soon as fn returns false.
+// Every key present during the whole walk is visited exactly once.
+//
+// walk 对持有表 t 第 i 个分片中key的每个存活分片调用 fn, 调用时分片已加锁(write 为 true 时加写锁).
+// fn 返回 false 时立即停止并返回 false.
+// 在整个遍历期间都存在的每个key恰好被访问一次.
+func walk[K comparable, V any](t *shardTable[K, V], i int, write bool, fn func(shard *ConcurrentMapShared[K, V]) bool) bool {
+	shard := t.shards[i]
+	if write {
+		shard.lock()
+	} else {
+		shard.rlock()
+	}
+	if atomic.LoadInt32(&shard.migrated) == 0 {
+		ok := fn(shard)
+		if write {
+			shard.Unlock()
+		} else {
+			shard.RUnlock()
+		}
+		return ok
+	}
+	if write {
+		shard.Unlock()
+	} else {
+		shard.RUnlock()
+	}
+	n := len(t.shards)
+	for j := i; j < len(t.next.shards); j += n {
+		if !walk(t.next, j, write, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkAll calls walk for every shard of the current table.
+//
+// walkAll 对当前表的每个分片调用 walk
+func (m ConcurrentMap[K, V]) walkAll(write bool, fn func(shard *ConcurrentMapShared[K, V]) bool) {
+	t := m.table()
+	for i := range t.shards {
+		if !walk(t, i, write, fn) {
+			return
+		}
+	}
+}
+
+// frozen calls fn while every live shard is locked for reading, so fn
+// sees a point-in-time view of the whole map. Shards are locked in table
+// order and unlocked after fn returns.
+//
+// frozen 在所有存活分片都加读锁时调用 fn, 因此 fn 看到的是整个map在某一时刻的视图.
+// 分片按分片表顺序加锁, 在 fn 返回之后解锁.
+func (m ConcurrentMap[K, V]) frozen(fn func(shards []*ConcurrentMapShared[K, V])) {
+	m.lockAll(false, fn)
+}
+
+// lockAll calls fn with every live shard, while all of them are locked
+// (for writing if write is true). Shards are locked in table order.
+//
+// lockAll 对所有存活的分片调用 fn, 调用时它们都已加锁(write 为 true 时加写锁). 分片按表的顺序加锁.
+func (m ConcurrentMap[K, V]) lockAll(write bool, fn func(shards []*ConcurrentMapShared[K, V])) {
+	var locked []*ConcurrentMapShared[K, V]
+	var lock func(t *shardTable[K, V], i int)
+	lock = func(t *shardTable[K, V], i int) {
+		shard := t.shards[i]
+		if write {
+			shard.lock()
+		} else {
+			shard.rlock()
+		}
+		if atomic.LoadInt32(&shard.migrated) == 0 {
+			locked = append(locked, shard)
+			return
+		}
+		if write {
+			shard.Unlock()
+		} else {
+			shard.RUnlock()
+		}
+		n := len(t.shards)
+		for j := i; j < len(t.next.shards); j += n {
+			lock(t.next, j)
+		}
+	}
+	t := m.table()
+	for i := range t.shards {
+		lock(t, i)
+	}
+	defer func() {
+		for _, shard := range locked {
+			if write {
+				shard.Unlock()
+			} else {
+				shard.RUnlock()
+			}
+		}
+	}()
+	fn(locked)
+}
+
+// owner returns the live shard of key without locking it. The result is
+// only stable while the shard is locked, e.g. inside lockAll.
+//
+// owner 返回key所在的存活分片, 但不加锁. 只有在分片已加锁时(例如 lockAll 内)结果才是稳定的.
+func (m ConcurrentMap[K, V]) owner(key K) *ConcurrentMapShared[K, V] {
+	hash := uint(m.sharding(key))
+	for t := m.table(); ; t = t.next {
+		shard := t.shards[hash%uint(len(t.shards))]
+		if atomic.LoadInt32(&shard.migrated) == 0 {
+			return shard
+		}
+	}
+}
+
+// Reshard migrates the map to n shards. Shards are migrated one by one,
+// reads and writes of other shards continue meanwhile.
+// n must be a multiple of the current shard count, e.g. twice as many.
+//
+// Reshard 将map迁移到 n 个分片. 分片被逐个迁移, 期间其他分片的读写不受影响.
+// n 必须是当前分片数量的倍数, 例如两倍.
+func (m ConcurrentMap[K, V]) Reshard(n int) error {
+	m.state.reshardMu.Lock()
+	defer m.state.reshardMu.Unlock()
+
+	old := m.table()
+	if n <= 0 {
+		return ErrInvalidShardCount
+	}
+	if n%len(old.shards) != 0 {
+		return ErrReshardNotMultiple
+	}
+	if n == len(old.shards) {
+		return nil
+	}
+
+	next := m.state.newTable(n)
+	old.next = next
+	for _, shard := range old.shards {
+		shard.Lock()
+		for key, value := range shard.items {
+			dst := next.shards[uint(m.sharding(key))%uint(n)]
+			dst.Lock()
+			dst.items[key] = value
+			if e, ok := shard.expires[key]; ok {
+				if dst.expires == nil {
+					dst.expires = make(map[K]int64)
+				}
+				dst.expires[key] = e
+			}
+			dst.Unlock()
+		}
+		if shard.lru != nil {
+			// Keep the recency order, least recently used first.
+			// 保持使用顺序, 最近最少使用的在前
+			for e := shard.lru.order.Back(); e != nil; e = e.Prev() {
+				key := e.Value.(K)
+				dst := next.shards[uint(m.sharding(key))%uint(n)]
+				dst.Lock()
+				dst.lru.touch(key)
+				dst.Unlock()
+			}
+		}
+		shard.items = nil
+		shard.expires = nil
+		shard.lru = nil
+		atomic.StoreInt32(&shard.migrated, 1)
+		shard.Unlock()
+	}
+	if m.state.stats {
+		// Published with next, so a Stats of next counts the old shards once.
+		// 与 next 一起发布, 因此对 next 的 Stats 只计算一次旧分片.
+		next.retired = &shardStats{}
+		if old.retired != nil {
+			next.retired.add(old.retired)
+		}
+		for _, shard := range old.shards {
+			next.retired.add(shard.stats)
+		}
+	}
+	m.state.table.Store(next)
+	return nil
+}
+
+// WithAutoReshard doubles the shard count in the background whenever a shard
+// holds more than maxLoad items, until maxShards is reached (0 means no limit).
+//
+// WithAutoReshard 在某个分片元素数量超过 maxLoad 时于后台将分片数量加倍,
+// 直到达到 maxShards (0 表示不限制).
+func WithAutoReshard(maxLoad, maxShards int) Option {
+	return func(o *options) {
+		o.maxLoad = maxLoad
+		o.maxShards = maxShards
+	}
+}
+
+// maybeGrow starts a background reshard if the locked shard is overloaded.
+//
+// maybeGrow 在已加锁的分片过载时启动后台重新分片
+func (m ConcurrentMap[K, V]) maybeGrow(shard *ConcurrentMapShared[K, V]) {
+	s := m.state
+	if s.maxLoad <= 0 || len(shard.items) <= s.maxLoad {
+		return
+	}
+	n := 2 * len(m.table().shards)
+	if s.maxShards > 0 && n > s.maxShards {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&s.growing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&s.growing, 0)
+		n := 2 * len(m.table().shards)
+		if s.maxShards > 0 && n > s.maxShards {
+			return
+		}
+		_ = m.Reshard(n)
+	}()
+}
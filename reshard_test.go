@@ -0,0 +1,133 @@
+package cmap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReshard(t *testing.T) {
+	m := NewWithShardCount[int](2)
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+
+	if err := m.Reshard(3); err != ErrReshardNotMultiple {
+		t.Error("Expecting ErrReshardNotMultiple, got", err)
+	}
+	if err := m.Reshard(0); err != ErrInvalidShardCount {
+		t.Error("Expecting ErrInvalidShardCount, got", err)
+	}
+	if err := m.Reshard(8); err != nil {
+		t.Fatal(err)
+	}
+	if m.ShardCount() != 8 {
+		t.Error("map should have exactly 8 shards.")
+	}
+	if m.Count() != 1000 || len(m.Keys()) != 1000 || len(m.Items()) != 1000 {
+		t.Error("We should have counted 1000 elements.")
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Error("missing value", i)
+		}
+	}
+}
+
+func TestReshardConcurrent(t *testing.T) {
+	m := NewWithShardCount[int](1)
+	const total = 2000
+	for i := 0; i < total; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := strconv.Itoa(i % total)
+				if v, ok := m.Get(key); !ok || v != i%total {
+					t.Error("lost value during reshard", key)
+					return
+				}
+				m.Set(key, i%total)
+				if n := m.Count(); n != total {
+					t.Error("Count changed during reshard", n)
+					return
+				}
+			}
+		}(w)
+	}
+	for n := 2; n <= 64; n *= 2 {
+		if err := m.Reshard(n); err != nil {
+			t.Error(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if len(m.Items()) != total {
+		t.Error("We should have counted", total, "elements.")
+	}
+}
+
+func TestLockShardReshard(t *testing.T) {
+	m := NewWithShardCount[int](1)
+	const total = 1000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 2; n <= 64; n *= 2 {
+			if err := m.Reshard(n); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < total; i++ {
+		key := strconv.Itoa(i)
+		shard := m.LockShard(key)
+		shard.GetMap()[key] = i
+		shard.Unlock()
+		shard = m.RLockShard(key)
+		v, ok := shard.GetMap()[key]
+		shard.RUnlock()
+		if !ok || v != i {
+			t.Fatal("lost value written under LockShard", key)
+		}
+	}
+	<-done
+	if m.Count() != total {
+		t.Error("expected", total, "entries, got", m.Count())
+	}
+}
+
+func TestAutoReshard(t *testing.T) {
+	m, err := NewWithOptions[string, int](WithShardCount(1), WithAutoReshard(16, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.ShardCount() < 8 && time.Now().Before(deadline) {
+		m.Set("0", 0)
+		time.Sleep(time.Millisecond)
+	}
+	if m.ShardCount() != 8 {
+		t.Error("map should have grown to 8 shards, got", m.ShardCount())
+	}
+	if m.Count() != 1000 {
+		t.Error("We should have counted 1000 elements.")
+	}
+}
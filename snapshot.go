@@ -0,0 +1,311 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot file format:
+//
+//	magic    "CMSS"
+//	version  1 byte, snapshotVersion
+//	schema   4 bytes little endian, set by WithSchemaVersion
+//	count    8 bytes little endian, number of entries
+//	expiry   count varints, the deadline of each entry in payload order in
+//	         Unix nanoseconds, 0 if it never expires (version 2 and later)
+//	payload  the MarshalBinary encoding of the entries
+//	checksum 4 bytes little endian, CRC-32C of everything before it
+//
+// Files of version 1 are still read, their entries never expire.
+//
+// 快照文件格式:
+// magic "CMSS", 1字节格式版本, 4字节小端值结构版本, 8字节小端元素数量,
+// 按元素顺序排列的 count 个 varint 过期时间(Unix纳秒, 0 表示永不过期, 版本2起),
+// MarshalBinary 编码的元素, 以及之前所有内容的4字节小端 CRC-32C 校验和.
+// 仍可读取版本1的文件, 其中的元素永不过期.
+
+const (
+	snapshotMagic      = "CMSS"
+	snapshotVersion    = 2
+	snapshotHeaderSize = len(snapshotMagic) + 1 + 4 + 8
+)
+
+var (
+	// ErrChecksum is returned when a snapshot file fails checksum verification.
+	//
+	// 快照文件校验和验证失败时返回 ErrChecksum
+	ErrChecksum = errors.New("cmap: snapshot checksum mismatch")
+	// ErrSchemaMismatch is returned when a snapshot file was written with
+	// another schema version than the one of the map.
+	//
+	// 快照文件的值结构版本与map的不同时返回 ErrSchemaMismatch
+	ErrSchemaMismatch = errors.New("cmap: snapshot schema version mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// SnapshotInfo is the header of a snapshot file.
+//
+// SnapshotInfo 是快照文件的头部
+type SnapshotInfo struct {
+	Version uint8  // format version / 格式版本
+	Schema  uint32 // schema version of the values / 值结构版本
+	Count   uint64 // number of entries / 元素数量
+}
+
+// WithSchemaVersion sets the schema version written to and expected from
+// snapshot files, 0 by default. Bump it when the layout of the values
+// changes, so that old files are rejected by LoadSnapshot.
+//
+// WithSchemaVersion 设置写入快照文件以及从快照文件中期望的值结构版本, 默认为 0.
+// 值的结构改变时增加它, 旧文件就会被 LoadSnapshot 拒绝.
+func WithSchemaVersion(v uint32) Option {
+	return func(o *options) {
+		o.schema = v
+	}
+}
+
+// SaveSnapshot writes a point-in-time Snapshot of the map to path, along
+// with the expiry deadline of the entries with a TTL. The file is written to
+// a temporary file in the same directory, synced, and renamed over path, so
+// path holds either the old or the new snapshot.
+//
+// SaveSnapshot 将map在某一时刻的快照(Snapshot)以及带过期时间元素的过期时刻写入 path.
+// 数据先写入同一目录下的临时文件并同步到磁盘, 然后重命名为 path, 因此 path 要么是旧快照, 要么是新快照.
+func (m ConcurrentMap[K, V]) SaveSnapshot(path string) error {
+	var entries []Tuple[K, timedValue[V]]
+	m.frozen(func(shards []*ConcurrentMapShared[K, V]) {
+		entries = liveEntries(shards)
+	})
+	if ok, less := m.canonical(); ok {
+		if err := sortItems(entries, less, binaryKey[K]); err != nil {
+			return err
+		}
+	}
+	items, deadlines := splitEntries(entries)
+	data, err := encodeSnapshot(items, deadlines, m.schema())
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// LoadSnapshot reads a snapshot file written by SaveSnapshot into the map,
+// combining entries as set by WithMergePolicy. Entries saved with a TTL
+// keep their deadline and those already expired are skipped; the others
+// get the default TTL of the map. The checksum, format and schema version
+// are verified and the whole file is decoded before the map is modified.
+// A zero value map is initialized first.
+//
+// LoadSnapshot 将 SaveSnapshot 写入的快照文件读取到map中, 按照 WithMergePolicy 的设置合并元素.
+// 保存时带过期时间的元素保留其过期时刻, 已过期的被跳过; 其他元素使用map的默认过期时间.
+// 在修改map之前会验证校验和, 格式版本和值结构版本, 并解码整个文件. 零值map会先被初始化.
+func (m *ConcurrentMap[K, V]) LoadSnapshot(path string) error {
+	items, deadlines, err := readSnapshot[K, V](path, m.schema())
+	if err != nil {
+		return err
+	}
+	return m.mergeAll(items, deadlines)
+}
+
+// ReadSnapshotInfo reads and verifies the snapshot file at path, and returns
+// its header without decoding the entries.
+//
+// ReadSnapshotInfo 读取并验证 path 处的快照文件, 返回其头部而不解码元素.
+func ReadSnapshotInfo(path string) (SnapshotInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	info, _, err := parseSnapshot(data)
+	return info, err
+}
+
+// schema returns the schema version of the map.
+//
+// schema 返回map的值结构版本
+func (m ConcurrentMap[K, V]) schema() uint32 {
+	if m.state == nil {
+		return 0
+	}
+	return m.state.schema
+}
+
+// timedValue is a value and its expiry deadline, 0 if it never expires.
+//
+// timedValue 是值及其过期时刻, 0 表示永不过期
+type timedValue[V any] struct {
+	val      V
+	deadline int64
+}
+
+// liveEntries returns the entries of the locked shards that are not
+// expired, with their deadlines.
+//
+// liveEntries 返回已加锁分片中未过期的元素及其过期时刻
+func liveEntries[K comparable, V any](shards []*ConcurrentMapShared[K, V]) []Tuple[K, timedValue[V]] {
+	var entries []Tuple[K, timedValue[V]]
+	now := time.Now().UnixNano()
+	for _, shard := range shards {
+		for key, val := range shard.items {
+			if !shard.expired(key, now) {
+				entries = append(entries, Tuple[K, timedValue[V]]{key, timedValue[V]{val, shard.expires[key]}})
+			}
+		}
+	}
+	return entries
+}
+
+// splitEntries splits entries into their items and deadlines.
+//
+// splitEntries 将 entries 拆分为元素和过期时刻
+func splitEntries[K comparable, V any](entries []Tuple[K, timedValue[V]]) ([]Tuple[K, V], []int64) {
+	items := make([]Tuple[K, V], len(entries))
+	deadlines := make([]int64, len(entries))
+	for i, e := range entries {
+		items[i] = Tuple[K, V]{e.Key, e.Val.val}
+		deadlines[i] = e.Val.deadline
+	}
+	return items, deadlines
+}
+
+// encodeSnapshot returns the snapshot file of items expiring at deadlines.
+//
+// encodeSnapshot 返回在 deadlines 时刻过期的 items 的快照文件内容
+func encodeSnapshot[K comparable, V any](items []Tuple[K, V], deadlines []int64, schema uint32) ([]byte, error) {
+	payload, err := encodeBinary(items)
+	if err != nil {
+		return nil, err
+	}
+	var tmp [binary.MaxVarintLen64]byte
+	buf := bytes.Buffer{}
+	buf.Grow(snapshotHeaderSize + len(items) + len(payload) + 4)
+	buf.WriteString(snapshotMagic)
+	buf.WriteByte(snapshotVersion)
+	binary.LittleEndian.PutUint32(tmp[:], schema)
+	buf.Write(tmp[:4])
+	binary.LittleEndian.PutUint64(tmp[:], uint64(len(items)))
+	buf.Write(tmp[:8])
+	for _, d := range deadlines {
+		buf.Write(tmp[:binary.PutVarint(tmp[:], d)])
+	}
+	buf.Write(payload)
+	binary.LittleEndian.PutUint32(tmp[:], crc32.Checksum(buf.Bytes(), castagnoli))
+	buf.Write(tmp[:4])
+	return buf.Bytes(), nil
+}
+
+// readSnapshot reads and verifies the snapshot file at path, and decodes its
+// entries and their deadlines, 0 for those that never expire.
+//
+// readSnapshot 读取并验证 path 处的快照文件, 并解码其中的元素及其过期时刻, 0 表示永不过期.
+func readSnapshot[K comparable, V any](path string, schema uint32) ([]Tuple[K, V], []int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, payload, err := parseSnapshot(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Schema != schema {
+		return nil, nil, fmt.Errorf("%w: file %d, map %d", ErrSchemaMismatch, info.Schema, schema)
+	}
+	var deadlines []int64
+	if info.Version >= 2 {
+		if info.Count > uint64(len(payload)) {
+			return nil, nil, ErrInvalidFormat
+		}
+		deadlines = make([]int64, info.Count)
+		for i := range deadlines {
+			d, n := binary.Varint(payload)
+			if n <= 0 {
+				return nil, nil, ErrInvalidFormat
+			}
+			deadlines[i], payload = d, payload[n:]
+		}
+	}
+	var items []Tuple[K, V]
+	err = decodeBinary(payload, func(key K, val V) error {
+		items = append(items, Tuple[K, V]{key, val})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if uint64(len(items)) != info.Count {
+		return nil, nil, ErrInvalidFormat
+	}
+	return items, deadlines, nil
+}
+
+// parseSnapshot verifies a snapshot file and splits it into header and payload.
+//
+// parseSnapshot 验证快照文件并将其拆分为头部和元素数据
+func parseSnapshot(data []byte) (SnapshotInfo, []byte, error) {
+	if len(data) < snapshotHeaderSize+4 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return SnapshotInfo{}, nil, ErrInvalidFormat
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.Checksum(body, castagnoli) != binary.LittleEndian.Uint32(sum) {
+		return SnapshotInfo{}, nil, ErrChecksum
+	}
+	header := body[len(snapshotMagic):]
+	info := SnapshotInfo{
+		Version: header[0],
+		Schema:  binary.LittleEndian.Uint32(header[1:]),
+		Count:   binary.LittleEndian.Uint64(header[5:]),
+	}
+	if info.Version < 1 || info.Version > snapshotVersion {
+		return info, nil, ErrUnsupportedVersion
+	}
+	return info, body[snapshotHeaderSize:], nil
+}
+
+// writeFileAtomic replaces path with data through a synced temporary file.
+//
+// writeFileAtomic 通过已同步到磁盘的临时文件将 path 替换为 data
+func writeFileAtomic(path string, data []byte) (err error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir syncs the directory dir so that renames in it survive a crash,
+// where supported.
+//
+// syncDir 在支持的系统上同步目录 dir, 使其中的重命名在崩溃后仍然有效.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,158 @@
+package cmap
+
+import (
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSaveLoadSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "map.snap")
+	m, _ := NewWithOptions[string, int](WithSchemaVersion(3))
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	if err := m.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	m.Set("100", 100)
+	if err := m.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Error("temporary files should not be left behind, got", len(entries), "files")
+	}
+
+	info, err := ReadSnapshotInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != (SnapshotInfo{Version: snapshotVersion, Schema: 3, Count: 101}) {
+		t.Error("unexpected snapshot info", info)
+	}
+
+	n, _ := NewWithOptions[string, int](WithSchemaVersion(3))
+	if err := n.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if n.Count() != 101 {
+		t.Error("Expecting 101 elements.")
+	}
+	for i := 0; i <= 100; i++ {
+		if v, ok := n.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Error("missing value", i)
+		}
+	}
+
+	var other ConcurrentMap[string, int]
+	if err := other.LoadSnapshot(path); !errors.Is(err, ErrSchemaMismatch) {
+		t.Error("expected ErrSchemaMismatch, got", err)
+	}
+	if err := other.LoadSnapshot(filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expected os.ErrNotExist, got", err)
+	}
+}
+
+func TestLoadSnapshotCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "map.snap")
+	m := New[string]()
+	m.Set("a", "b")
+	if err := m.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+
+	corrupt := func(data []byte, expected error) {
+		t.Helper()
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		n := New[string]()
+		if err := n.LoadSnapshot(path); !errors.Is(err, expected) {
+			t.Error("expected", expected, "got", err)
+		}
+		if n.Count() != 0 {
+			t.Error("a corrupted snapshot should not modify the map")
+		}
+	}
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-6] ^= 1
+	corrupt(flipped, ErrChecksum)
+	corrupt(data[:len(data)-1], ErrChecksum)
+	corrupt(data[:5], ErrInvalidFormat)
+	corrupt([]byte("not a snapshot file"), ErrInvalidFormat)
+
+	n := New[int]()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.LoadSnapshot(path); !errors.Is(err, ErrInvalidFormat) {
+		t.Error("mismatched value type should be rejected, got", err)
+	}
+}
+
+func TestSnapshotTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.snap")
+	m, _ := NewWithOptions[string, int]()
+	m.Set("forever", 1)
+	m.SetWithTTL("later", 2, time.Hour)
+	m.SetWithTTL("soon", 3, 20*time.Millisecond)
+	if err := m.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	n, _ := NewWithOptions[string, int]()
+	if err := n.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if n.Count() != 3 {
+		t.Error("Expecting 3 elements, got", n.Count())
+	}
+	for key, expected := range map[string]bool{"forever": false, "later": true} {
+		shard := n.rlockShard(key)
+		deadline, ok := shard.expires[key]
+		shard.RUnlock()
+		if ok != expected || ok && time.Until(time.Unix(0, deadline)) <= 59*time.Minute {
+			t.Error("the deadline of", key, "should be kept, got", deadline, ok)
+		}
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	e, _ := NewWithOptions[string, int]()
+	if err := e.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if e.Has("soon") || e.Count() != 2 {
+		t.Error("expired entries should be skipped")
+	}
+}
+
+func TestLoadSnapshotVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.snap")
+	payload, err := encodeBinary([]Tuple[string, int]{{"a", 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(snapshotMagic), 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0)
+	data = append(data, payload...)
+	sum := crc32.Checksum(data, castagnoli)
+	data = append(data, byte(sum), byte(sum>>8), byte(sum>>16), byte(sum>>24))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New[int]()
+	if err := m.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m.Get("a"); !ok || v != 1 {
+		t.Error("entries of a version 1 file should be loaded")
+	}
+}
@@ -0,0 +1,181 @@
+package cmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithStats enables per shard operation and lock contention counters,
+// reported by Stats. They cost a few atomic additions per operation.
+//
+// WithStats 开启每个分片的操作和锁竞争计数, 由 Stats 返回. 每次操作会增加几次原子加法的开销.
+func WithStats() Option {
+	return func(o *options) {
+		o.stats = true
+	}
+}
+
+// ShardStats are the counters of a shard, or of the whole map.
+//
+// ShardStats 是一个分片或整个map的计数
+type ShardStats struct {
+	Gets      uint64        // Get and Has calls / Get 和 Has 调用次数
+	Hits      uint64        // Gets that found the key / 找到key的 Gets 次数
+	Misses    uint64        // Gets that did not find the key / 未找到key的 Gets 次数
+	Sets      uint64        // keys set / 设置key的次数
+	Removes   uint64        // keys removed, expired or evicted / 删除, 过期或淘汰key的次数
+	Contended uint64        // lock acquisitions that had to wait / 需要等待的加锁次数
+	LockWait  time.Duration // total time spent waiting for the lock / 等待锁的总时间
+	Size      int           // current number of keys, including expired ones not yet removed / 当前key的数量, 包括尚未删除的过期key
+}
+
+// Stats are the counters of every shard and their sum.
+//
+// Stats 是每个分片的计数及其总和
+type Stats struct {
+	Shards []ShardStats
+	Total  ShardStats
+}
+
+// shardStats are the live counters of a shard.
+//
+// shardStats 是分片的实时计数
+type shardStats struct {
+	gets      uint64
+	hits      uint64
+	sets      uint64
+	removes   uint64
+	contended uint64
+	lockWait  int64
+}
+
+// add adds the counters of o to s.
+//
+// add 将 o 的计数加到 s
+func (s *shardStats) add(o *shardStats) {
+	atomic.AddUint64(&s.gets, atomic.LoadUint64(&o.gets))
+	atomic.AddUint64(&s.hits, atomic.LoadUint64(&o.hits))
+	atomic.AddUint64(&s.sets, atomic.LoadUint64(&o.sets))
+	atomic.AddUint64(&s.removes, atomic.LoadUint64(&o.removes))
+	atomic.AddUint64(&s.contended, atomic.LoadUint64(&o.contended))
+	atomic.AddInt64(&s.lockWait, atomic.LoadInt64(&o.lockWait))
+}
+
+func (s *shardStats) snapshot() ShardStats {
+	gets, hits := atomic.LoadUint64(&s.gets), atomic.LoadUint64(&s.hits)
+	return ShardStats{
+		Gets:      gets,
+		Hits:      hits,
+		Misses:    gets - hits,
+		Sets:      atomic.LoadUint64(&s.sets),
+		Removes:   atomic.LoadUint64(&s.removes),
+		Contended: atomic.LoadUint64(&s.contended),
+		LockWait:  time.Duration(atomic.LoadInt64(&s.lockWait)),
+	}
+}
+
+// Stats returns the counters of every shard and their sum. Without
+// WithStats only the sizes are reported. Resharding restarts the counters
+// of the shards, but not the total. Stats does not wait for a Reshard in
+// progress: the counters of a shard being migrated include those of the
+// shards taking its keys, so none is missed or counted twice.
+//
+// Stats 返回每个分片的计数及其总和. 未使用 WithStats 时只返回大小. 重新分片会重置各分片的计数, 但不会重置总和.
+// Stats 不会等待进行中的 Reshard: 正在迁移的分片的计数包括接收其key的分片的计数, 因此不会遗漏或重复.
+func (m ConcurrentMap[K, V]) Stats() Stats {
+	t := m.table()
+	st := Stats{Shards: make([]ShardStats, len(t.shards))}
+	if t.retired != nil {
+		st.Total = t.retired.snapshot()
+	}
+	for i := range t.shards {
+		st.Shards[i] = statsAt(t, i)
+		st.Total.add(st.Shards[i])
+	}
+	return st
+}
+
+// statsAt returns the counters of shard i of table t, and of the shards of
+// the next tables taking its keys if it was migrated.
+//
+// statsAt 返回表 t 第 i 个分片的计数, 若该分片已迁移, 还包括后续表中接收其key的分片的计数.
+func statsAt[K comparable, V any](t *shardTable[K, V], i int) ShardStats {
+	shard := t.shards[i]
+	var s ShardStats
+	shard.rlock()
+	if shard.stats != nil {
+		s = shard.stats.snapshot()
+	}
+	s.Size = len(shard.items)
+	migrated := atomic.LoadInt32(&shard.migrated) != 0
+	shard.RUnlock()
+	if migrated {
+		n := len(t.shards)
+		for j := i; j < len(t.next.shards); j += n {
+			s.add(statsAt(t.next, j))
+		}
+	}
+	return s
+}
+
+// add adds the counters of o to s.
+//
+// add 将 o 的计数加到 s
+func (s *ShardStats) add(o ShardStats) {
+	s.Gets += o.Gets
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.Sets += o.Sets
+	s.Removes += o.Removes
+	s.Contended += o.Contended
+	s.LockWait += o.LockWait
+	s.Size += o.Size
+}
+
+// lock locks the shard for writing, recording the wait when stats are enabled.
+//
+// lock 为分片加写锁, 开启统计时记录等待时间
+func (cms *ConcurrentMapShared[K, V]) lock() {
+	if cms.stats == nil {
+		cms.Lock()
+		return
+	}
+	if !cms.TryLock() {
+		start := time.Now()
+		cms.Lock()
+		cms.stats.waited(time.Since(start))
+	}
+}
+
+// rlock locks the shard for reading, recording the wait when stats are enabled.
+//
+// rlock 为分片加读锁, 开启统计时记录等待时间
+func (cms *ConcurrentMapShared[K, V]) rlock() {
+	if cms.stats == nil {
+		cms.RLock()
+		return
+	}
+	if !cms.TryRLock() {
+		start := time.Now()
+		cms.RLock()
+		cms.stats.waited(time.Since(start))
+	}
+}
+
+func (s *shardStats) waited(d time.Duration) {
+	atomic.AddUint64(&s.contended, 1)
+	atomic.AddInt64(&s.lockWait, int64(d))
+}
+
+// countGet counts a Get or Has of the shard.
+//
+// countGet 统计分片的一次 Get 或 Has
+func (cms *ConcurrentMapShared[K, V]) countGet(hit bool) {
+	if cms.stats == nil {
+		return
+	}
+	atomic.AddUint64(&cms.stats.gets, 1)
+	if hit {
+		atomic.AddUint64(&cms.stats.hits, 1)
+	}
+}
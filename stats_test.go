@@ -0,0 +1,147 @@
+package cmap
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	m, err := NewWithOptions[string, int](WithStats(), WithShardCount(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	m.Get("1")
+	m.Get("missing")
+	m.Has("2")
+	m.Remove("3")
+	m.SetWithTTL("ttl", 1, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	m.Get("ttl")
+
+	st := m.Stats()
+	if len(st.Shards) != 4 {
+		t.Fatal("Expecting 4 shards, got", len(st.Shards))
+	}
+	expected := ShardStats{Gets: 4, Hits: 2, Misses: 2, Sets: 11, Removes: 2, Size: 9}
+	got := st.Total
+	got.Contended, got.LockWait = 0, 0
+	if got != expected {
+		t.Errorf("Total = %+v, expected %+v", got, expected)
+	}
+	var sets uint64
+	for _, s := range st.Shards {
+		sets += s.Sets
+	}
+	if sets != st.Total.Sets {
+		t.Error("Total should be the sum of the shards")
+	}
+
+	if err := m.Reshard(8); err != nil {
+		t.Fatal(err)
+	}
+	m.Set("a", 1)
+	st = m.Stats()
+	if len(st.Shards) != 8 || st.Total.Sets != 12 || st.Total.Size != 10 {
+		t.Errorf("resharding should keep the total, got %+v", st.Total)
+	}
+}
+
+func TestStatsLockWait(t *testing.T) {
+	m, _ := NewWithOptions[string, int](WithStats(), WithShardCount(1))
+	shard := m.lockShard("a")
+	done := make(chan struct{})
+	go func() {
+		m.Get("a")
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	shard.Unlock()
+	<-done
+
+	st := m.Stats()
+	if st.Total.Contended != 1 || st.Total.LockWait < 5*time.Millisecond {
+		t.Errorf("lock wait should be recorded, got %+v", st.Total)
+	}
+
+	// Waits to lock every shard are recorded too.
+	shard = m.lockShard("a")
+	done = make(chan struct{})
+	go func() {
+		m.Snapshot()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	shard.Unlock()
+	<-done
+	if st := m.Stats(); st.Total.Contended != 2 {
+		t.Errorf("the wait of Snapshot should be recorded, got %+v", st.Total)
+	}
+}
+
+func TestStatsReshard(t *testing.T) {
+	m, _ := NewWithOptions[string, int](WithStats(), WithShardCount(1))
+	// Stats does not wait for a Reshard.
+	m.state.reshardMu.Lock()
+	done := make(chan struct{})
+	go func() {
+		m.Stats()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Stats should not wait for the reshard lock")
+	}
+	m.state.reshardMu.Unlock()
+	<-done
+
+	const total = 1000
+	for i := 0; i < total; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 2; n <= 256; n *= 2 {
+			if err := m.Reshard(n); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		st := m.Stats()
+		if n := len(st.Shards); n&(n-1) != 0 {
+			t.Fatal("shards of two tables reported together:", n)
+		}
+		var sets uint64
+		for _, s := range st.Shards {
+			sets += s.Sets
+		}
+		if sets > total {
+			t.Fatal("shards should not count sets twice, got", sets)
+		}
+		if st.Total.Sets != total || st.Total.Size != total {
+			t.Fatalf("counters should not change while resharding, got %+v", st.Total)
+		}
+	}
+}
+
+func TestStatsDisabled(t *testing.T) {
+	m := New[int]()
+	m.Set("a", 1)
+	m.Get("a")
+	st := m.Stats()
+	if len(st.Shards) != SHARD_COUNT || st.Total != (ShardStats{Size: 1}) {
+		t.Errorf("only sizes should be reported without WithStats, got %+v", st.Total)
+	}
+}
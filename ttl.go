@@ -0,0 +1,158 @@
+package cmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithDefaultTTL sets the TTL used by Set, MSet, Upsert and SetIfAbsent.
+// By default keys never expire.
+//
+// WithDefaultTTL 设置 Set, MSet, Upsert 和 SetIfAbsent 使用的过期时间, 默认永不过期.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.defaultTTL = ttl
+	}
+}
+
+// WithCleanupInterval sets how often expired keys are removed in the
+// background, one minute by default.
+//
+// WithCleanupInterval 设置后台删除过期key的间隔, 默认为一分钟.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.cleanup = interval
+	}
+}
+
+// SetWithTTL sets the given value under the specified key, the key expires
+// after ttl. A ttl <= 0 means the key never expires.
+// Expired keys are invisible and removed lazily or by a background janitor,
+// which is started by the first key with a TTL and stopped by Close.
+//
+// SetWithTTL 设置指定key下的给定值, 该key在 ttl 之后过期, ttl <= 0 表示永不过期.
+// 过期的key不可见, 它们在访问时或由后台清理协程删除, 该协程在第一个设置了过期时间的key写入时启动, 由 Close 停止.
+func (m ConcurrentMap[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	shard := m.lockShard(key)
+	m.store(shard, key, value, ttl)
+	shard.Unlock()
+}
+
+// DeleteExpired removes all expired keys, locking one shard at a time.
+//
+// DeleteExpired 删除所有过期的key, 每次只锁定一个分片.
+func (m ConcurrentMap[K, V]) DeleteExpired() {
+	m.walkAll(true, func(shard *ConcurrentMapShared[K, V]) bool {
+		now := time.Now().UnixNano()
+		for key, e := range shard.expires {
+			if e <= now {
+				m.removeAs(shard, key, EventExpire)
+			}
+		}
+		return true
+	})
+}
+
+// Close stops the background janitor, and with WithWAL syncs and closes the
+// write-ahead log, returning its first error. The map stays usable,
+// expired keys are still removed lazily, but writes are no longer logged.
+//
+// Close 停止后台清理协程, 使用 WithWAL 时同步并关闭预写日志, 返回其第一个错误.
+// map仍然可用, 过期的key仍会在访问时删除, 但写入不再被记录到日志.
+func (m ConcurrentMap[K, V]) Close() error {
+	s := m.state
+	s.janitorMu.Lock()
+	if s.closed {
+		s.janitorMu.Unlock()
+		return nil
+	}
+	s.closed = true
+	atomic.StoreInt32(&s.janitorDone, 1)
+	if s.janitor != nil {
+		close(s.janitor)
+	}
+	s.janitorMu.Unlock()
+	if s.wal != nil {
+		return s.wal.close()
+	}
+	return nil
+}
+
+// startJanitor starts the background janitor unless it runs or the map is closed.
+//
+// startJanitor 启动后台清理协程, 除非它已在运行或map已关闭
+func (m ConcurrentMap[K, V]) startJanitor() {
+	s := m.state
+	if atomic.LoadInt32(&s.janitorDone) == 1 {
+		return
+	}
+	s.janitorMu.Lock()
+	defer s.janitorMu.Unlock()
+	if s.janitor != nil || s.closed {
+		return
+	}
+	atomic.StoreInt32(&s.janitorDone, 1)
+	s.janitor = make(chan struct{})
+	interval := s.cleanup
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.DeleteExpired()
+			}
+		}
+	}(s.janitor)
+}
+
+// expire removes key if it is expired.
+//
+// expire 在key过期时将其删除
+func (m ConcurrentMap[K, V]) expire(key K) {
+	shard := m.lockShard(key)
+	if shard.expiredNow(key) {
+		m.removeAs(shard, key, EventExpire)
+	}
+	shard.Unlock()
+}
+
+// expired reports whether key is expired at now, the shard must be locked.
+//
+// expired 报告key在 now 时是否已过期, 分片必须已加锁
+func (cms *ConcurrentMapShared[K, V]) expired(key K, now int64) bool {
+	e, ok := cms.expires[key]
+	return ok && e <= now
+}
+
+// expiredNow reports whether key is expired, the shard must be locked.
+//
+// expiredNow 报告key当前是否已过期, 分片必须已加锁
+func (cms *ConcurrentMapShared[K, V]) expiredNow(key K) bool {
+	if len(cms.expires) == 0 {
+		return false
+	}
+	return cms.expired(key, time.Now().UnixNano())
+}
+
+// countExpired returns the number of expired keys, the shard must be locked.
+//
+// countExpired 返回过期key的数量, 分片必须已加锁
+func (cms *ConcurrentMapShared[K, V]) countExpired() int {
+	if len(cms.expires) == 0 {
+		return 0
+	}
+	now := time.Now().UnixNano()
+	n := 0
+	for _, e := range cms.expires {
+		if e <= now {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,109 @@
+package cmap
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	m := New[Animal]()
+	defer m.Close()
+
+	m.SetWithTTL("monkey", Animal{"monkey"}, time.Millisecond)
+	m.SetWithTTL("elephant", Animal{"elephant"}, time.Hour)
+	m.Set("tiger", Animal{"tiger"})
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := m.Get("monkey"); ok {
+		t.Error("expired element should not be returned")
+	}
+	if m.Has("monkey") {
+		t.Error("expired element shouldn't exists")
+	}
+	if !m.Has("elephant") || !m.Has("tiger") {
+		t.Error("element exists, expecting Has to return True.")
+	}
+	if m.Count() != 2 || len(m.Items()) != 2 || len(m.Keys()) != 2 {
+		t.Error("map should contain exactly two elements.")
+	}
+
+	// Overwriting without TTL removes the expiration.
+	m.SetWithTTL("elephant", Animal{"elephant"}, time.Millisecond)
+	m.Set("elephant", Animal{"elephant"})
+	time.Sleep(5 * time.Millisecond)
+	if !m.Has("elephant") {
+		t.Error("Set should clear the TTL.")
+	}
+}
+
+func TestExpiredIsAbsent(t *testing.T) {
+	m := New[int]()
+	defer m.Close()
+
+	m.SetWithTTL("a", 1, time.Millisecond)
+	m.SetWithTTL("b", 1, time.Millisecond)
+	m.SetWithTTL("c", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if !m.SetIfAbsent("a", 2) {
+		t.Error("expired element should be treated as absent")
+	}
+	m.Upsert("b", 2, func(exist bool, valueInMap int, newValue int) int {
+		if exist {
+			t.Error("expired element should be treated as absent")
+		}
+		return newValue
+	})
+	if _, ok := m.Pop("c"); ok {
+		t.Error("Pop should not return expired element")
+	}
+}
+
+func TestDefaultTTLAndJanitor(t *testing.T) {
+	removed := make(chan string, 100)
+	m, err := NewWithOptions[string, int](
+		WithDefaultTTL(time.Millisecond),
+		WithCleanupInterval(time.Millisecond),
+		WithHooks(Hooks[string, int]{OnRemove: func(key string, old int) {
+			removed <- key
+		}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for i := 0; i < 10; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case <-removed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("janitor did not remove expired elements")
+		}
+	}
+	stored := 0
+	m.walkAll(false, func(shard *ConcurrentMapShared[string, int]) bool {
+		stored += len(shard.items)
+		return true
+	})
+	if stored != 0 {
+		t.Error("We should have 0 elements.")
+	}
+}
+
+func TestCloseStopsJanitor(t *testing.T) {
+	m := New[int]()
+	m.Close()
+	m.Close()
+	m.SetWithTTL("a", 1, time.Millisecond)
+	if m.state.janitor != nil {
+		t.Error("janitor should not start after Close")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if m.Has("a") {
+		t.Error("expired element should still be removed lazily")
+	}
+}
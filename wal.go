@@ -0,0 +1,572 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Write-ahead log files in the WithWAL directory:
+//
+//	map.snap    snapshot file (see SaveSnapshot) of the entries at the last compaction
+//	map.wal     records appended since the last compaction
+//	map.wal.old records of a compaction in progress
+//
+// A record is a uvarint length, the body and the CRC-32C of the body as 4
+// bytes little endian. The body is an op byte followed by the key and, for
+// walSet, the expiry time (varint UnixNano, 0 for none) and the value, in
+// the MarshalBinary encoding. Recovery loads the snapshot and replays
+// map.wal.old then map.wal, ignoring a torn record at the end of a log.
+//
+// 预写日志目录中的文件:
+// map.snap 为上次压缩时元素的快照文件(见 SaveSnapshot), map.wal 为上次压缩之后追加的记录,
+// map.wal.old 为正在进行的压缩的记录.
+// 每条记录为 uvarint 长度, 记录体, 以及记录体的4字节小端 CRC-32C. 记录体为操作字节, key,
+// 对于 walSet 还有过期时间(varint UnixNano, 0 表示无)和值, 编码方式与 MarshalBinary 相同.
+// 恢复时加载快照, 然后重放 map.wal.old 和 map.wal, 忽略日志末尾不完整的记录.
+
+// ErrCorruptWAL is returned when a record of a write-ahead log is corrupted
+// and is not the last one, so it is not a torn write.
+//
+// 预写日志中的记录损坏且不是最后一条(因此不是写入不完整)时返回 ErrCorruptWAL
+var ErrCorruptWAL = errors.New("cmap: write-ahead log is corrupted")
+
+const (
+	walSnapshotFile = "map.snap"
+	walLogFile      = "map.wal"
+	walOldFile      = "map.wal.old"
+
+	walSet    byte = 1
+	walRemove byte = 2
+
+	defaultCompactSize = 64 << 20
+)
+
+// SyncPolicy decides when the write-ahead log is synced to disk.
+//
+// SyncPolicy 决定预写日志何时同步到磁盘
+type SyncPolicy int
+
+const (
+	// SyncEverySecond syncs the log once a second in the background, a crash
+	// loses at most about one second of writes. It is the default.
+	//
+	// SyncEverySecond 每秒在后台同步一次日志, 崩溃时最多丢失约一秒的写入. 这是默认值.
+	SyncEverySecond SyncPolicy = iota
+	// SyncAlways syncs the log after every write, while the shard lock is held.
+	//
+	// SyncAlways 在每次写入之后同步日志, 此时仍持有分片的锁.
+	SyncAlways
+	// SyncNever leaves syncing to the operating system, the log survives
+	// process crashes but not system crashes.
+	//
+	// SyncNever 由操作系统决定何时同步, 日志可以在进程崩溃后保留, 但系统崩溃时可能丢失.
+	SyncNever
+)
+
+// WithWAL makes the map durable: every Set, Remove, Upsert result, Pop,
+// expiry and eviction is appended to a write-ahead log in dir, which is
+// replayed by NewWithOptions and compacted into a snapshot in the
+// background. dir is created if needed. Close syncs and closes the log.
+//
+// WithWAL 使map持久化: 每次 Set, Remove, Upsert 的结果, Pop, 过期和淘汰都会追加到 dir 中的预写日志,
+// NewWithOptions 会重放该日志, 并在后台将其压缩为快照. dir 不存在时会被创建. Close 会同步并关闭日志.
+func WithWAL(dir string) Option {
+	return func(o *options) {
+		o.walDir = dir
+	}
+}
+
+// WithSyncPolicy sets when the write-ahead log is synced to disk,
+// SyncEverySecond by default.
+//
+// WithSyncPolicy 设置预写日志何时同步到磁盘, 默认为 SyncEverySecond
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(o *options) {
+		o.syncPolicy = policy
+	}
+}
+
+// WithCompactSize sets the size in bytes of the write-ahead log that
+// triggers a background compaction, 64 MiB by default.
+//
+// WithCompactSize 设置触发后台压缩的预写日志大小(字节), 默认为 64 MiB
+func WithCompactSize(size int64) Option {
+	return func(o *options) {
+		o.compactSize = size
+	}
+}
+
+// wal is the write-ahead log of a map.
+//
+// wal 是map的预写日志
+type wal[K comparable, V any] struct {
+	dir         string
+	policy      SyncPolicy
+	compactSize int64
+
+	mu     sync.Mutex // 保护以下字段
+	file   *os.File   // 当前日志文件
+	size   int64      // 当前日志文件大小
+	dirty  bool       // 是否有未同步的写入
+	err    error      // 第一个写入错误, 之后不再写入日志
+	closed bool       // Close 是否已被调用
+
+	compactMu   sync.Mutex    // 同一时间只允许一次压缩, 并保护以下两个字段
+	compactErr  error         // 上一次后台压缩的错误
+	compactions int           // 已完成轮换的压缩次数
+	compact     chan struct{} // 请求后台压缩
+	stop        chan struct{} // 关闭以停止后台协程
+	done        chan struct{} // 后台协程退出时关闭
+}
+
+// openWAL replays the write-ahead log in dir into m, and attaches it.
+// m must not be shared yet.
+//
+// openWAL 将 dir 中的预写日志重放到 m 中并关联该日志. m 此时不能已被共享.
+func openWAL[K comparable, V any](m ConcurrentMap[K, V], dir string, policy SyncPolicy, compactSize int64) error {
+	if compactSize <= 0 {
+		compactSize = defaultCompactSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	items, deadlines, err := readSnapshot[K, V](filepath.Join(dir, walSnapshotFile), m.schema())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	now := time.Now().UnixNano()
+	for i, item := range items {
+		var deadline int64
+		if deadlines != nil {
+			deadline = deadlines[i]
+		}
+		if deadline != 0 && deadline <= now {
+			continue
+		}
+		shard := m.lockShard(item.Key)
+		m.restore(shard, item.Key, item.Val, deadline)
+		shard.Unlock()
+	}
+	if _, err := m.replayWAL(filepath.Join(dir, walOldFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	size, err := m.replayWAL(filepath.Join(dir, walLogFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, walLogFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w := &wal[K, V]{
+		dir:         dir,
+		policy:      policy,
+		compactSize: compactSize,
+		file:        file,
+		size:        size,
+		compact:     make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	m.state.wal = w
+
+	// Finish a compaction interrupted by a crash.
+	// 完成因崩溃而中断的压缩
+	if _, err := os.Stat(filepath.Join(dir, walOldFile)); err == nil {
+		if err := m.Compact(); err != nil {
+			m.state.wal = nil
+			file.Close()
+			return err
+		}
+	}
+	go w.run(m)
+
+	// Start what replaying skipped, now that the log is attached.
+	// 日志已关联, 启动重放时跳过的后台任务
+	timed := false
+	m.walkAll(false, func(shard *ConcurrentMapShared[K, V]) bool {
+		timed = timed || len(shard.expires) > 0
+		m.maybeGrow(shard)
+		return true
+	})
+	if timed {
+		m.startJanitor()
+	}
+	return nil
+}
+
+// restore stores a replayed entry in the locked shard, expiring at deadline
+// unless 0. Unlike store, it neither logs, runs the hooks, notifies the
+// watchers nor starts the janitor or auto resharding.
+//
+// restore 在已加锁的分片中存储重放的元素, deadline 不为 0 时在该时刻过期.
+// 与 store 不同, 它不记录日志, 不执行回调, 不通知订阅者, 也不启动清理协程或自动重新分片.
+func (m ConcurrentMap[K, V]) restore(shard *ConcurrentMapShared[K, V], key K, value V, deadline int64) {
+	shard.items[key] = value
+	if deadline != 0 {
+		if shard.expires == nil {
+			shard.expires = make(map[K]int64)
+		}
+		shard.expires[key] = deadline
+	} else if shard.expires != nil {
+		delete(shard.expires, key)
+	}
+	if shard.lru != nil {
+		m.used(shard, key)
+	}
+}
+
+// replayWAL applies the records of the log at path to m, truncates a torn
+// record at its end, and returns the size of the valid records. A corrupted
+// record followed by others fails with ErrCorruptWAL, the log is kept.
+//
+// replayWAL 将 path 处日志中的记录应用到 m, 截断末尾不完整的记录, 并返回有效记录的大小.
+// 损坏的记录之后还有其他记录时返回 ErrCorruptWAL, 日志保持不变.
+func (m ConcurrentMap[K, V]) replayWAL(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	off := 0
+	for off < len(data) {
+		n, k := binary.Uvarint(data[off:])
+		rest := len(data) - off - k - 4
+		if k <= 0 || rest < 0 || n > uint64(rest) {
+			break
+		}
+		body := data[off+k : off+k+int(n)]
+		end := off + k + int(n) + 4
+		if crc32.Checksum(body, castagnoli) != binary.LittleEndian.Uint32(data[end-4:end]) {
+			if end < len(data) {
+				return 0, fmt.Errorf("%w: %s at offset %d", ErrCorruptWAL, path, off)
+			}
+			break
+		}
+		if err := m.replayRecord(body); err != nil {
+			return 0, err
+		}
+		off = end
+	}
+	if off < len(data) {
+		if err := os.Truncate(path, int64(off)); err != nil {
+			return 0, err
+		}
+	}
+	return int64(off), nil
+}
+
+// replayRecord applies a single record body to m.
+//
+// replayRecord 将单条记录体应用到 m
+func (m ConcurrentMap[K, V]) replayRecord(body []byte) error {
+	var (
+		key K
+		val V
+	)
+	if len(body) == 0 {
+		return ErrInvalidFormat
+	}
+	r := &binaryReader{r: bytes.NewReader(body[1:])}
+	if err := r.read(binaryKindOf(reflect.TypeOf((*K)(nil)).Elem()), reflect.ValueOf(&key).Elem()); err != nil {
+		return err
+	}
+	shard := m.lockShard(key)
+	defer shard.Unlock()
+	switch body[0] {
+	case walSet:
+		deadline, err := binary.ReadVarint(r.r)
+		if err != nil {
+			return ErrInvalidFormat
+		}
+		if err := r.read(binaryKindOf(reflect.TypeOf((*V)(nil)).Elem()), reflect.ValueOf(&val).Elem()); err != nil {
+			return err
+		}
+		if deadline != 0 && deadline <= time.Now().UnixNano() {
+			m.remove(shard, key)
+			return nil
+		}
+		m.restore(shard, key, val, deadline)
+	case walRemove:
+		m.remove(shard, key)
+	default:
+		return ErrInvalidFormat
+	}
+	if r.r.Len() != 0 {
+		return ErrInvalidFormat
+	}
+	return nil
+}
+
+// encodeWALRecord returns the record of op on key.
+//
+// encodeWALRecord 返回对key进行 op 操作的记录
+func encodeWALRecord[K comparable, V any](op byte, key K, val V, deadline int64) ([]byte, error) {
+	bw := &binaryWriter{}
+	bw.buf.WriteByte(op)
+	if err := bw.write(binaryKindOf(reflect.TypeOf((*K)(nil)).Elem()), reflect.ValueOf(&key).Elem()); err != nil {
+		return nil, err
+	}
+	if op == walSet {
+		bw.buf.Write(bw.tmp[:binary.PutVarint(bw.tmp[:], deadline)])
+		if err := bw.write(binaryKindOf(reflect.TypeOf((*V)(nil)).Elem()), reflect.ValueOf(&val).Elem()); err != nil {
+			return nil, err
+		}
+	}
+	body := bw.buf.Bytes()
+	n := binary.PutUvarint(bw.tmp[:], uint64(len(body)))
+	rec := make([]byte, n+len(body)+4)
+	copy(rec, bw.tmp[:n])
+	copy(rec[n:], body)
+	binary.LittleEndian.PutUint32(rec[n+len(body):], crc32.Checksum(body, castagnoli))
+	return rec, nil
+}
+
+// set logs that key was set to val, expiring at deadline unless 0.
+// The shard of key must be locked.
+//
+// set 记录key被设置为 val, deadline 不为 0 时在该时刻过期. key所在的分片必须已加锁.
+func (w *wal[K, V]) set(key K, val V, deadline int64) {
+	rec, err := encodeWALRecord(walSet, key, val, deadline)
+	w.append(rec, err)
+}
+
+// remove logs that key was removed. The shard of key must be locked.
+//
+// remove 记录key被删除. key所在的分片必须已加锁.
+func (w *wal[K, V]) remove(key K) {
+	var val V
+	rec, err := encodeWALRecord(walRemove, key, val, 0)
+	w.append(rec, err)
+}
+
+// append writes rec to the log, or records err as the first write error.
+//
+// append 将 rec 写入日志, 或将 err 记录为第一个写入错误
+func (w *wal[K, V]) append(rec []byte, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.err != nil {
+		return
+	}
+	if err != nil {
+		w.err = err
+		return
+	}
+	if _, err := w.file.Write(rec); err != nil {
+		w.err = err
+		return
+	}
+	w.size += int64(len(rec))
+	if w.policy == SyncAlways {
+		if err := w.file.Sync(); err != nil {
+			w.err = err
+		}
+	} else {
+		w.dirty = true
+	}
+	if w.size >= w.compactSize {
+		select {
+		case w.compact <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// sync syncs unsynced writes to disk and returns the first write error.
+//
+// sync 将未同步的写入同步到磁盘, 并返回第一个写入错误
+func (w *wal[K, V]) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dirty && !w.closed && w.err == nil {
+		w.dirty = false
+		if err := w.file.Sync(); err != nil {
+			w.err = err
+		}
+	}
+	return w.err
+}
+
+// run syncs and compacts the log in the background until stopped.
+//
+// run 在后台同步和压缩日志, 直到被停止
+func (w *wal[K, V]) run(m ConcurrentMap[K, V]) {
+	defer close(w.done)
+	var tick <-chan time.Time
+	if w.policy == SyncEverySecond {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-tick:
+			w.sync()
+		case <-w.compact:
+			err := m.Compact()
+			w.compactMu.Lock()
+			w.compactErr = err
+			w.compactMu.Unlock()
+		}
+	}
+}
+
+// Sync syncs the write-ahead log to disk, and returns the first error
+// writing it; after a write error nothing more is logged. It does nothing
+// without WithWAL.
+//
+// Sync 将预写日志同步到磁盘, 并返回写入日志的第一个错误; 写入出错后不再记录任何内容.
+// 未使用 WithWAL 时不做任何事.
+func (m ConcurrentMap[K, V]) Sync() error {
+	if m.state == nil || m.state.wal == nil {
+		return nil
+	}
+	return m.state.wal.sync()
+}
+
+// Compact writes the entries and their deadlines to the snapshot of the
+// write-ahead log and starts a new empty log. Writes are blocked only while
+// the log is rotated, not while the snapshot is written. It runs in the
+// background when the log exceeds WithCompactSize, and does nothing without
+// WithWAL.
+//
+// Compact 将元素及其过期时刻写入预写日志的快照, 并开始新的空日志.
+// 写入只在轮换日志时被阻塞, 写入快照时不会. 日志超过 WithCompactSize 时它会在后台运行, 未使用 WithWAL 时不做任何事.
+func (m ConcurrentMap[K, V]) Compact() error {
+	if m.state == nil || m.state.wal == nil {
+		return nil
+	}
+	w := m.state.wal
+	w.compactMu.Lock()
+	defer w.compactMu.Unlock()
+
+	var (
+		entries []Tuple[K, timedValue[V]]
+		err     error
+	)
+	m.frozen(func(shards []*ConcurrentMapShared[K, V]) {
+		entries = liveEntries(shards)
+		err = w.rotate()
+	})
+	if err != nil {
+		return err
+	}
+	w.compactions++
+	items, deadlines := splitEntries(entries)
+	data, err := encodeSnapshot(items, deadlines, m.schema())
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(w.dir, walSnapshotFile), data); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(w.dir, walOldFile)); err != nil {
+		return err
+	}
+	syncDir(w.dir)
+	return nil
+}
+
+// rotate moves the current log to map.wal.old and starts a new empty one.
+// All shards must be locked.
+//
+// rotate 将当前日志移动到 map.wal.old 并开始新的空日志. 所有分片必须已加锁.
+func (w *wal[K, V]) rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	cur, old := filepath.Join(w.dir, walLogFile), filepath.Join(w.dir, walOldFile)
+	if _, err := os.Stat(old); err == nil {
+		// A failed compaction left map.wal.old behind, keep its records.
+		// 失败的压缩留下了 map.wal.old, 保留其中的记录
+		if err := appendFile(old, cur); err != nil {
+			return err
+		}
+		if err := os.Remove(cur); err != nil {
+			return err
+		}
+	} else if err := os.Rename(cur, old); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(cur, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	syncDir(w.dir)
+	w.file.Close()
+	w.file = file
+	w.size = 0
+	w.dirty = false
+	return nil
+}
+
+// close stops the background goroutine, then syncs and closes the log.
+// It returns the first write error, or the error of the last background
+// compaction. It must be called once.
+//
+// close 停止后台协程, 然后同步并关闭日志. 返回第一个写入错误或上一次后台压缩的错误. 只能调用一次.
+func (w *wal[K, V]) close() error {
+	close(w.stop)
+	<-w.done
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	err := w.err
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.compactMu.Lock()
+	if err == nil {
+		err = w.compactErr
+	}
+	w.compactMu.Unlock()
+	return err
+}
+
+// appendFile appends the contents of src to dst and syncs dst.
+//
+// appendFile 将 src 的内容追加到 dst 并同步 dst
+func appendFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
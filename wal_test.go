@@ -0,0 +1,278 @@
+package cmap
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestWAL(t *testing.T, dir string, opts ...Option) ConcurrentMap[string, int] {
+	t.Helper()
+	m, err := NewWithOptions[string, int](append([]Option{WithWAL(dir)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestWALReplay(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestWAL(t, dir, WithSyncPolicy(SyncAlways))
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.MSet(map[string]int{"c": 3, "d": 4})
+	m.Remove("b")
+	m.Upsert("a", 10, func(exist bool, old, new int) int { return old + new })
+	m.Pop("c")
+	m.SetWithTTL("ttl", 5, time.Hour)
+	m.SetWithTTL("gone", 6, time.Millisecond)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m.Set("after", 1)
+
+	time.Sleep(5 * time.Millisecond)
+	n := openTestWAL(t, dir)
+	defer n.Close()
+	expected := map[string]int{"a": 11, "d": 4, "ttl": 5}
+	if n.Count() != len(expected) {
+		t.Error("replayed", n.Items(), "expected", expected)
+	}
+	for key, val := range expected {
+		if v, ok := n.Get(key); !ok || v != val {
+			t.Error("key", key, "replayed as", v, ok)
+		}
+	}
+	if n.Has("after") {
+		t.Error("writes after Close should not be logged")
+	}
+	shard := n.rlockShard("ttl")
+	deadline := shard.expires["ttl"]
+	shard.RUnlock()
+	if time.Until(time.Unix(0, deadline)) <= 0 {
+		t.Error("TTL should be replayed")
+	}
+}
+
+func TestWALTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestWAL(t, dir, WithSyncPolicy(SyncNever))
+	m.Set("a", 1)
+	m.Set("b", 2)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, walLogFile)
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, data[:len(data)-1], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n := openTestWAL(t, dir)
+	if !n.Has("a") || n.Has("b") {
+		t.Error("only the complete record should be replayed, got", n.Items())
+	}
+	n.Set("c", 3)
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n = openTestWAL(t, dir)
+	defer n.Close()
+	if !n.Has("a") || !n.Has("c") || n.Count() != 2 {
+		t.Error("records after a torn record should replay, got", n.Items())
+	}
+}
+
+func TestWALCompact(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestWAL(t, dir)
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	m.SetWithTTL("ttl", 1, time.Hour)
+	if err := m.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, walOldFile)); !os.IsNotExist(err) {
+		t.Error("compaction should remove the old log")
+	}
+	info, err := ReadSnapshotInfo(filepath.Join(dir, walSnapshotFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Count != 101 {
+		t.Error("snapshot should hold all 101 entries, got", info.Count)
+	}
+	if size, _ := os.Stat(filepath.Join(dir, walLogFile)); size.Size() != 0 {
+		t.Error("compaction should start an empty log, got", size.Size(), "bytes")
+	}
+	m.Remove("0")
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	n := openTestWAL(t, dir)
+	defer n.Close()
+	if n.Count() != 100 || n.Has("0") || !n.Has("99") || !n.Has("ttl") {
+		t.Error("unexpected replay after compaction", n.Count())
+	}
+}
+
+func TestWALCompactTTL(t *testing.T) {
+	const compactSize = 16 << 10
+	m, err := NewWithOptions[string, string](WithWAL(t.TempDir()), WithCompactSize(compactSize), WithSyncPolicy(SyncNever))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	w := m.state.wal
+	compactions := func() int {
+		w.compactMu.Lock()
+		defer w.compactMu.Unlock()
+		return w.compactions
+	}
+	// The entries with a TTL alone are larger than the compaction threshold.
+	val := string(bytes.Repeat([]byte("v"), 100))
+	for i := 0; i < 500; i++ {
+		m.SetWithTTL(strconv.Itoa(i), val, time.Hour)
+	}
+	if err := m.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	before := compactions()
+	for i := 0; i < 100; i++ {
+		m.SetWithTTL(strconv.Itoa(i), val, time.Hour)
+		time.Sleep(time.Millisecond)
+	}
+	// 100 records of about 120 bytes stay below the threshold.
+	if n := compactions() - before; n > 1 {
+		t.Error("entries with a TTL should not trigger a compaction per write, got", n)
+	}
+}
+
+func TestWALInterruptedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestWAL(t, dir)
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Close()
+	// Crash after the log was rotated, before the snapshot was written.
+	if err := os.Rename(filepath.Join(dir, walLogFile), filepath.Join(dir, walOldFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	n := openTestWAL(t, dir)
+	n.Remove("a")
+	n.Set("c", 3)
+	n.Close()
+	if _, err := os.Stat(filepath.Join(dir, walOldFile)); !os.IsNotExist(err) {
+		t.Error("an interrupted compaction should be finished on open")
+	}
+	n = openTestWAL(t, dir)
+	defer n.Close()
+	if n.Count() != 2 || !n.Has("b") || !n.Has("c") {
+		t.Error("unexpected replay", n.Items())
+	}
+}
+
+func TestWALBackgroundCompaction(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestWAL(t, dir, WithCompactSize(1<<10))
+	wg := sync.WaitGroup{}
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := strconv.Itoa(i % 50)
+				if i%7 == g {
+					m.Remove(key)
+				} else {
+					m.Set(key, g*1000+i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	expected := m.Items()
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, walSnapshotFile)); err != nil {
+		t.Error("the log should have been compacted in the background:", err)
+	}
+
+	n := openTestWAL(t, dir)
+	defer n.Close()
+	if n.Count() != len(expected) {
+		t.Error("replayed", n.Count(), "entries, expected", len(expected))
+	}
+	for key, val := range expected {
+		if v, ok := n.Get(key); !ok || v != val {
+			t.Error("key", key, "replayed as", v, "expected", val)
+		}
+	}
+}
+
+func TestWALDisabled(t *testing.T) {
+	m := New[int]()
+	if err := m.Sync(); err != nil {
+		t.Error(err)
+	}
+	if err := m.Compact(); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewWithOptions[string, int](WithWAL(filepath.Join(t.TempDir(), "file", "\x00"))); err == nil {
+		t.Error("invalid WAL directory should be rejected")
+	}
+}
+
+func TestWALReplayExpiring(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestWAL(t, dir)
+	for i := 0; i < 100; i++ {
+		m.SetWithTTL(strconv.Itoa(i), i, time.Duration(i)*time.Microsecond+time.Millisecond)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	n := openTestWAL(t, dir, WithCleanupInterval(time.Microsecond), WithAutoReshard(2, 0))
+	time.Sleep(5 * time.Millisecond)
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n.Count() != 0 {
+		t.Error("replayed entries should expire, got", n.Count())
+	}
+}
+
+func TestWALCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestWAL(t, dir)
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Set("c", 3)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, walLogFile)
+	data, _ := os.ReadFile(path)
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(data)/2] ^= 0xff
+	if err := os.WriteFile(path, corrupted, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWithOptions[string, int](WithWAL(dir)); !errors.Is(err, ErrCorruptWAL) {
+		t.Error("expected ErrCorruptWAL, got", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, corrupted) {
+		t.Error("a corrupted log should not be truncated")
+	}
+}
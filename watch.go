@@ -0,0 +1,225 @@
+package cmap
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultWatchBuffer = 64
+
+// EventType is the kind of change an Event reports.
+//
+// EventType 是 Event 报告的修改类型
+type EventType int
+
+const (
+	// EventSet reports that a key was set by Set, MSet, Upsert, SetIfAbsent or SetWithTTL.
+	//
+	// EventSet 报告key被 Set, MSet, Upsert, SetIfAbsent 或 SetWithTTL 设置
+	EventSet EventType = iota + 1
+	// EventRemove reports that a key was removed by Remove, RemoveCb, Pop or Clear.
+	//
+	// EventRemove 报告key被 Remove, RemoveCb, Pop 或 Clear 删除
+	EventRemove
+	// EventExpire reports that an expired key was removed.
+	//
+	// EventExpire 报告过期的key被删除
+	EventExpire
+	// EventEvict reports that a key was evicted by WithMaxEntries.
+	//
+	// EventEvict 报告key因 WithMaxEntries 被淘汰
+	EventEvict
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventRemove:
+		return "remove"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	}
+	return "unknown"
+}
+
+// Event is a change of the map delivered by Watch and WatchKey.
+//
+// Event 是 Watch 和 WatchKey 传递的map修改
+type Event[K comparable, V any] struct {
+	Type  EventType
+	Key   K
+	Value V // the new value for EventSet, the removed value otherwise / EventSet 为新值, 其他为被删除的值
+}
+
+// WatchPolicy decides what happens when a watcher's buffer is full.
+//
+// WatchPolicy 决定订阅者缓冲区已满时的行为
+type WatchPolicy int
+
+const (
+	// WatchDrop drops events for a watcher whose buffer is full, writers never
+	// wait. It is the default.
+	//
+	// WatchDrop 在订阅者缓冲区已满时丢弃事件, 写入永不等待. 这是默认值.
+	WatchDrop WatchPolicy = iota
+	// WatchBlock makes writers wait until a watcher with a full buffer
+	// receives or its context is done. The shard lock is held meanwhile, so a
+	// slow watcher blocks every writer of the keys it watches, and any other
+	// writer of the same shard. Writers of other shards are not affected,
+	// except while decoding under MergeFailOnConflict, which holds the lock
+	// of every shard as it sets the entries.
+	//
+	// WatchBlock 使写入等待, 直到缓冲区已满的订阅者接收或其上下文结束.
+	// 等待时持有分片的锁, 因此慢的订阅者会阻塞其订阅的key的所有写入,
+	// 以及同一分片的其他写入. 其他分片的写入不受影响,
+	// 但 MergeFailOnConflict 下的解码除外, 它在设置元素时持有所有分片的锁.
+	WatchBlock
+)
+
+// WithWatchBuffer sets the buffer size of the channels returned by Watch
+// and WatchKey, 64 by default.
+//
+// WithWatchBuffer 设置 Watch 和 WatchKey 返回的管道的缓冲区大小, 默认为 64
+func WithWatchBuffer(n int) Option {
+	return func(o *options) {
+		o.watchBuffer = n
+	}
+}
+
+// WithWatchPolicy sets what happens when a watcher's buffer is full,
+// WatchDrop by default.
+//
+// WithWatchPolicy 设置订阅者缓冲区已满时的行为, 默认为 WatchDrop
+func WithWatchPolicy(policy WatchPolicy) Option {
+	return func(o *options) {
+		o.watchPolicy = policy
+	}
+}
+
+// watchers are the subscribers of a map.
+//
+// watchers 是map的订阅者
+type watchers[K comparable, V any] struct {
+	mu   sync.Mutex   // 串行化 list 的修改
+	list atomic.Value // []*watcher[K, V], 订阅者, 修改时整体替换, 读取时不加锁
+}
+
+// load returns the current watchers, it MUST NOT be modified.
+//
+// load 返回当前的订阅者, 不能修改它
+func (ws *watchers[K, V]) load() []*watcher[K, V] {
+	list, _ := ws.list.Load().([]*watcher[K, V])
+	return list
+}
+
+type watcher[K comparable, V any] struct {
+	ch     chan Event[K, V]
+	ctx    context.Context
+	key    K
+	hasKey bool
+	mu     sync.RWMutex // 发送时持有读锁, 关闭 ch 时持有写锁
+	closed bool         // ch 是否已关闭
+}
+
+// Watch returns a channel receiving an Event after each change of the map,
+// until ctx is done, when the channel is closed. Events of a key arrive in
+// the order of its changes; they are sent while the shard lock is held.
+// The buffer size and the behavior when it is full are set by
+// WithWatchBuffer and WithWatchPolicy.
+//
+// Watch 返回一个管道, map每次修改之后它会收到一个 Event, 直到 ctx 结束时管道被关闭.
+// 同一个key的事件按修改顺序到达; 事件在持有分片锁时发送.
+// 缓冲区大小以及缓冲区已满时的行为由 WithWatchBuffer 和 WithWatchPolicy 设置.
+func (m ConcurrentMap[K, V]) Watch(ctx context.Context) <-chan Event[K, V] {
+	return m.watch(ctx, &watcher[K, V]{})
+}
+
+// WatchKey is Watch for the changes of key only.
+//
+// WatchKey 与 Watch 相同, 但只接收key的修改
+func (m ConcurrentMap[K, V]) WatchKey(ctx context.Context, key K) <-chan Event[K, V] {
+	return m.watch(ctx, &watcher[K, V]{key: key, hasKey: true})
+}
+
+func (m ConcurrentMap[K, V]) watch(ctx context.Context, w *watcher[K, V]) <-chan Event[K, V] {
+	s := m.state
+	size := s.watchBuffer
+	if size <= 0 {
+		size = defaultWatchBuffer
+	}
+	w.ch = make(chan Event[K, V], size)
+	w.ctx = ctx
+
+	ws := &s.watchers
+	ws.mu.Lock()
+	cur := ws.load()
+	ws.list.Store(append(cur[:len(cur):len(cur)], w))
+	ws.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		ws.mu.Lock()
+		cur := ws.load()
+		list := make([]*watcher[K, V], 0, len(cur))
+		for _, x := range cur {
+			if x != w {
+				list = append(list, x)
+			}
+		}
+		ws.list.Store(list)
+		ws.mu.Unlock()
+
+		// A sender blocked on w gives up as ctx is done, so this does not wait long.
+		// 阻塞在 w 上的发送者会因 ctx 结束而放弃, 因此这里不会等待很久.
+		w.mu.Lock()
+		w.closed = true
+		close(w.ch)
+		w.mu.Unlock()
+	}()
+	return w.ch
+}
+
+// notify sends an event to the watchers, the shard of key must be locked.
+//
+// notify 向订阅者发送事件, key所在的分片必须已加锁
+func (m ConcurrentMap[K, V]) notify(typ EventType, key K, value V) {
+	list := m.state.watchers.load()
+	if len(list) == 0 {
+		return
+	}
+	e := Event[K, V]{typ, key, value}
+	block := m.state.watchPolicy == WatchBlock
+	for _, w := range list {
+		if w.hasKey && w.key != key {
+			continue
+		}
+		w.send(e, block)
+	}
+}
+
+// send sends e to the watcher unless its channel is closed, waiting for
+// room if block is true.
+//
+// send 在订阅者的管道未关闭时向其发送 e, block 为 true 时等待缓冲区有空位.
+func (w *watcher[K, V]) send(e Event[K, V], block bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+	if block {
+		select {
+		case w.ch <- e:
+		case <-w.ctx.Done():
+		}
+		return
+	}
+	select {
+	case w.ch <- e:
+	default:
+	}
+}
@@ -0,0 +1,214 @@
+package cmap
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func receive[K comparable, V any](t *testing.T, ch <-chan Event[K, V]) Event[K, V] {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return Event[K, V]{}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m, _ := NewWithOptions[string, int](WithWatchBuffer(100), WithMaxEntries(100))
+	ch := m.Watch(ctx)
+
+	m.Set("a", 1)
+	m.MSet(map[string]int{"b": 2})
+	m.Upsert("a", 10, func(exist bool, old, new int) int { return old + new })
+	m.Remove("b")
+	m.RemoveCb("a", func(key string, v int, exists bool) bool { return true })
+	m.Set("c", 3)
+	m.Pop("c")
+	m.Remove("missing")
+	m.SetWithTTL("d", 4, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	m.Get("d")
+
+	expected := []Event[string, int]{
+		{EventSet, "a", 1},
+		{EventSet, "b", 2},
+		{EventSet, "a", 11},
+		{EventRemove, "b", 2},
+		{EventRemove, "a", 11},
+		{EventSet, "c", 3},
+		{EventRemove, "c", 3},
+		{EventSet, "d", 4},
+		{EventExpire, "d", 4},
+	}
+	for _, e := range expected {
+		if got := receive(t, ch); got != e {
+			t.Errorf("got event %v, expected %v", got, e)
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+	m.Set("e", 5)
+}
+
+func TestWatchKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := New[int]()
+	ch := m.WatchKey(ctx, "a")
+	m.Set("b", 1)
+	m.Set("a", 2)
+	if e := receive(t, ch); e.Key != "a" || e.Value != 2 {
+		t.Error("WatchKey should only receive events of its key, got", e)
+	}
+	select {
+	case e := <-ch:
+		t.Error("unexpected event", e)
+	default:
+	}
+}
+
+func TestWatchEvict(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, _ := NewWithOptions[string, int](WithShardCount(1), WithMaxEntries(1))
+	ch := m.WatchKey(ctx, "a")
+	m.Set("a", 1)
+	m.Set("b", 2)
+	receive(t, ch)
+	if e := receive(t, ch); e.Type != EventEvict || e.Value != 1 {
+		t.Error("expected an evict event, got", e)
+	}
+}
+
+func TestWatchPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, _ := NewWithOptions[string, int](WithWatchBuffer(1))
+	ch := m.Watch(ctx)
+	for i := 0; i < 3; i++ {
+		m.Set("a", i)
+	}
+	if e := receive(t, ch); e.Value != 0 {
+		t.Error("expected the first event, got", e)
+	}
+	select {
+	case e := <-ch:
+		t.Error("events should be dropped when the buffer is full, got", e)
+	default:
+	}
+
+	b, _ := NewWithOptions[string, int](WithWatchBuffer(1), WithWatchPolicy(WatchBlock))
+	ch = b.Watch(ctx)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			b.Set("a", i)
+		}
+		close(done)
+	}()
+	for i := 0; i < 3; i++ {
+		if e := receive(t, ch); e.Value != i {
+			t.Error("expected event", i, "got", e)
+		}
+	}
+	<-done
+
+	// A blocked writer is released when the watcher's context is done.
+	wctx, wcancel := context.WithCancel(context.Background())
+	w, _ := NewWithOptions[string, int](WithWatchBuffer(1), WithWatchPolicy(WatchBlock))
+	w.Watch(wctx)
+	w.Set("b", 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		wcancel()
+	}()
+	w.Set("b", 2)
+}
+
+func TestWatchBlockCancel(t *testing.T) {
+	m, _ := NewWithOptions[string, int](WithWatchBuffer(1), WithWatchPolicy(WatchBlock))
+	bctx, bcancel := context.WithCancel(context.Background())
+	defer bcancel()
+	m.WatchKey(bctx, "a")
+	m.Set("a", 1)
+	blocked := make(chan struct{})
+	go func() {
+		m.Set("a", 2) // blocks until bcancel
+		close(blocked)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// Cancelling another watcher closes its channel while the writer is blocked.
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := m.Watch(ctx)
+	cancel()
+	for {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				continue
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the channel of a cancelled watcher should be closed")
+		}
+		break
+	}
+
+	// Writers of other shards are not stalled.
+	other := "b"
+	for i := 0; m.GetShard(other) == m.GetShard("a"); i++ {
+		other = strconv.Itoa(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		m.Set(other, 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a writer of another shard should not wait for a blocked watcher")
+	}
+	bcancel()
+	<-blocked
+}
+
+func TestWatchNotifyLockFree(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := New[int]()
+	ch := m.Watch(ctx)
+	// Writers read the watchers without taking the registry lock.
+	m.state.watchers.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		m.Set("a", 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("a writer should not wait for the registry lock")
+	}
+	m.state.watchers.mu.Unlock()
+	<-done
+	if e := receive(t, ch); e.Key != "a" {
+		t.Error("unexpected event", e)
+	}
+}
+
+func TestEventTypeString(t *testing.T) {
+	for typ, s := range map[EventType]string{EventSet: "set", EventRemove: "remove", EventExpire: "expire", EventEvict: "evict", 0: "unknown"} {
+		if typ.String() != s {
+			t.Error(typ.String(), "!=", s)
+		}
+	}
+}